@@ -0,0 +1,166 @@
+package fastcommp
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Aggregate is a piece made of other pieces, such as the unsealed sector
+// whose piece CID is its CommD, or a deal aggregating smaller deals
+type Aggregate struct {
+	PieceCID  cid.Cid
+	PieceSize abi.PaddedPieceSize
+	// Pieces are the pieces aggregated, in order, at their offsets
+	Pieces []PlacedPiece
+	// ZeroPieces are the zero pieces before pieces not aligned to their
+	// size, and after the last piece up to PieceSize or the IndexOffset
+	ZeroPieces []PlacedPiece
+
+	// Index is the FRC-0058 data segment index of an AggregateDeal, with an
+	// entry per piece, which fills the end of the deal from IndexOffset
+	Index       []SegmentEntry      `json:",omitempty"`
+	IndexOffset abi.PaddedPieceSize `json:",omitempty"`
+}
+
+// PlacedPiece is a piece at an offset of an aggregate
+type PlacedPiece struct {
+	PieceCID cid.Cid
+	Size     abi.PaddedPieceSize
+	// Offset is the padded offset of the piece in the aggregate, a
+	// multiple of its size
+	Offset abi.PaddedPieceSize
+}
+
+// AggregatePieces returns the aggregate of size holding pieces in order, as
+// lotus places deals in a sector: each piece at the next multiple of its
+// size, after the zero pieces filling the gap, and zero pieces after the
+// last one up to size. A size of 0 is the smallest piece that holds them.
+func AggregatePieces(size abi.PaddedPieceSize, pieces []abi.PieceInfo) (Aggregate, error) {
+	return aggregate(size, pieces, false)
+}
+
+// AggregateDeal is like AggregatePieces for a deal of dealSize aggregating
+// the pieces of many clients, per FRC-0058: the end of the deal holds the
+// data segment index of its pieces, so that each can be found and proven to
+// be in the deal. A dealSize of 0 is the smallest deal that holds them.
+func AggregateDeal(dealSize abi.PaddedPieceSize, pieces []abi.PieceInfo) (Aggregate, error) {
+	return aggregate(dealSize, pieces, true)
+}
+
+// aggregate returns the aggregate of size holding pieces, followed by their
+// data segment index with index
+func aggregate(size abi.PaddedPieceSize, pieces []abi.PieceInfo, index bool) (Aggregate, error) {
+	if len(pieces) == 0 {
+		return Aggregate{}, xerrors.New("no pieces to aggregate")
+	}
+	commPs := make([]commitment, len(pieces))
+	offsets := make([]abi.PaddedPieceSize, len(pieces))
+	var end abi.PaddedPieceSize
+	for i, p := range pieces {
+		if err := p.Size.Validate(); err != nil {
+			return Aggregate{}, xerrors.Errorf("piece %d: %w", i, err)
+		}
+		commP, err := cidCommitment(p.PieceCID)
+		if err != nil {
+			return Aggregate{}, xerrors.Errorf("piece %d: invalid piece CID %s: %w", i, p.PieceCID, err)
+		}
+		commPs[i] = commP
+		offsets[i] = (end + p.Size - 1) / p.Size * p.Size
+		if offsets[i] < end {
+			return Aggregate{}, xerrors.Errorf("piece %d overflows the aggregate", i)
+		}
+		end = offsets[i] + p.Size
+		if end < offsets[i] {
+			return Aggregate{}, xerrors.Errorf("piece %d overflows the aggregate", i)
+		}
+	}
+	// the pieces end by limit, before the index if any
+	limit := func(size abi.PaddedPieceSize) abi.PaddedPieceSize {
+		if index {
+			return SegmentIndexOffset(size)
+		}
+		return size
+	}
+	if size == 0 {
+		fits := func(size abi.PaddedPieceSize) bool {
+			if !index {
+				return size >= end
+			}
+			return int(size) >= 2*MaxSegmentEntries(size)*SegmentEntrySize && limit(size) >= end && MaxSegmentEntries(size) >= len(pieces)
+		}
+		for size = minPieceSize; !fits(size); size *= 2 {
+			if size == maxPieceSize {
+				return Aggregate{}, xerrors.Errorf("pieces take %d bytes with their alignment, more than any aggregate holds", end)
+			}
+		}
+	} else if err := size.Validate(); err != nil {
+		return Aggregate{}, xerrors.Errorf("invalid aggregate size: %w", err)
+	}
+	if index && int(size) < 2*MaxSegmentEntries(size)*SegmentEntrySize {
+		return Aggregate{}, xerrors.Errorf("a deal of %d bytes is too small for a data segment index", size)
+	}
+	if end > limit(size) {
+		if index {
+			return Aggregate{}, xerrors.Errorf("pieces take %d bytes with their alignment, more than the %d a deal of %d holds before its data segment index", end, limit(size), size)
+		}
+		return Aggregate{}, xerrors.Errorf("pieces take %d bytes with their alignment, more than the aggregate of %d", end, size)
+	}
+	if index && len(pieces) > MaxSegmentEntries(size) {
+		return Aggregate{}, xerrors.Errorf("%d pieces are more than the data segment index of a deal of %d bytes holds, %d", len(pieces), size, MaxSegmentEntries(size))
+	}
+
+	agg := Aggregate{PieceSize: size}
+	st := new(merkleStack)
+	var offset abi.PaddedPieceSize
+	zeros := func(to abi.PaddedPieceSize) error {
+		for offset < to {
+			// the largest zero piece at offset that ends by to
+			z := offset & -offset
+			if offset == 0 {
+				z = size
+			}
+			for offset+z > to {
+				z /= 2
+			}
+			c, err := ZeroPieceCID(z)
+			if err != nil {
+				return err
+			}
+			st.push(z, zeroCommitment(z))
+			agg.ZeroPieces = append(agg.ZeroPieces, PlacedPiece{PieceCID: c, Size: z, Offset: offset})
+			offset += z
+		}
+		return nil
+	}
+	for i, p := range pieces {
+		if err := zeros(offsets[i]); err != nil {
+			return Aggregate{}, err
+		}
+		st.push(p.Size, commPs[i])
+		agg.Pieces = append(agg.Pieces, PlacedPiece{PieceCID: p.PieceCID, Size: p.Size, Offset: offset})
+		offset += p.Size
+	}
+	if err := zeros(limit(size)); err != nil {
+		return Aggregate{}, err
+	}
+	if index {
+		agg.Index = make([]SegmentEntry, len(pieces))
+		for i, p := range agg.Pieces {
+			agg.Index[i] = newSegmentEntry(p, commPs[i])
+		}
+		agg.IndexOffset = offset
+		nodes, err := segmentIndex(size, agg.Index)
+		if err != nil {
+			return Aggregate{}, err
+		}
+		st.push(size-offset, treeRoot(nodes))
+	}
+
+	c, err := st.frames[0].commP.pieceCID()
+	if err != nil {
+		return Aggregate{}, xerrors.Errorf("converting piece commitment: %w", err)
+	}
+	agg.PieceCID = c
+	return agg, nil
+}
@@ -0,0 +1,196 @@
+package fastcommp
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-commp-utils/nonffi"
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+func TestAggregatePieces(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, proof := range []abi.RegisteredSealProof{
+		abi.RegisteredSealProof_StackedDrg2KiBV1_1,
+		abi.RegisteredSealProof_StackedDrg8MiBV1_1,
+	} {
+		sector, _ := proof.SectorSize()
+		for i := 0; i < 30; i++ {
+			// pieces of random sizes, in random order, that fit the sector
+			// however they are aligned
+			var pieces []abi.PieceInfo
+			var total abi.PaddedPieceSize
+			for n := 1 + rng.Intn(8); len(pieces) < n; {
+				size := abi.PaddedPieceSize(128) << rng.Intn(bits.TrailingZeros64(uint64(sector)/128)+1)
+				if 2*(total+size) > abi.PaddedPieceSize(sector) {
+					break
+				}
+				commP := make([]byte, 32)
+				rng.Read(commP)
+				commP[31] &= 0x3f
+				c, err := commitment(commP).pieceCID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				pieces = append(pieces, abi.PieceInfo{Size: size, PieceCID: c})
+				total += size
+			}
+			if len(pieces) == 0 {
+				continue
+			}
+			// nonffi stops at the smallest tree that holds the pieces, which
+			// PadCommP of go-fil-commp-hashhash pads to the sector
+			want, err := nonffi.GenerateUnsealedCID(proof, pieces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			small, err := AggregatePieces(0, pieces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !small.PieceCID.Equals(want) {
+				t.Errorf("%v: %s of %d bytes, expected %s", pieces, small.PieceCID, small.PieceSize, want)
+			}
+			agg, err := AggregatePieces(abi.PaddedPieceSize(sector), pieces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := padCID(t, want, small.PieceSize, abi.PaddedPieceSize(sector)); !agg.PieceCID.Equals(want) {
+				t.Errorf("sector of %d bytes of %v: %s, expected %s", sector, pieces, agg.PieceCID, want)
+			}
+		}
+	}
+}
+
+func TestAggregateOverflow(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	piece := func(size abi.PaddedPieceSize) abi.PieceInfo {
+		var commP commitment
+		rng.Read(commP[:])
+		commP[31] &= 0x3f
+		c, err := commP.pieceCID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return abi.PieceInfo{Size: size, PieceCID: c}
+	}
+	for _, tc := range []struct {
+		name   string
+		pieces []abi.PieceInfo
+	}{
+		// the last piece would end at 1<<64, which wraps to 0
+		{"ending past the address space", []abi.PieceInfo{piece(1 << 62), piece(1 << 63)}},
+		{"aligned past the address space", []abi.PieceInfo{piece(128), piece(1 << 63), piece(1 << 63)}},
+	} {
+		if _, err := AggregatePieces(0, tc.pieces); err == nil {
+			t.Errorf("%s: aggregated", tc.name)
+		}
+		if _, err := AggregateDeal(0, tc.pieces); err == nil {
+			t.Errorf("%s: aggregated in a deal", tc.name)
+		}
+	}
+	// a deal of the largest size has no room for its index after such a
+	// piece, and no larger deal can be searched for
+	if _, err := AggregateDeal(0, []abi.PieceInfo{piece(1 << 63)}); err == nil {
+		t.Errorf("a piece of 1<<63 bytes aggregated in a deal")
+	}
+}
+
+func TestSealProofPadding(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, tc := range []struct {
+		proof abi.RegisteredSealProof
+		size  int
+	}{
+		{abi.RegisteredSealProof_StackedDrg2KiBV1_1, 1},
+		{abi.RegisteredSealProof_StackedDrg2KiBV1_1, 64},
+		{abi.RegisteredSealProof_StackedDrg2KiBV1_1, 65},
+		{abi.RegisteredSealProof_StackedDrg2KiBV1_1, 2032},
+		{abi.RegisteredSealProof_StackedDrg8MiBV1_1, 100000},
+		{abi.RegisteredSealProof_StackedDrg8MiBV1_1, 8 << 20 / 128 * 127},
+	} {
+		data := make([]byte, tc.size)
+		rng.Read(data)
+		sum, err := SumBytes(data, WithSealProof(tc.proof))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the payload of under 127 bytes is padded with zeros, as the lotus
+		// client does
+		if len(data) < 127 {
+			data = append(data, make([]byte, 127-len(data))...)
+		}
+		c, size := refPieceCID(t, data)
+		want, err := nonffi.GenerateUnsealedCID(tc.proof, []abi.PieceInfo{{Size: size, PieceCID: c}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sector, _ := tc.proof.SectorSize()
+		if want := padCID(t, want, size, abi.PaddedPieceSize(sector)); !sum.PieceCID.Equals(want) || sum.PieceSize != abi.PaddedPieceSize(sector) {
+			t.Errorf("%d bytes in a sector of %d: %s of %d bytes, expected %s", tc.size, sector, sum.PieceCID, sum.PieceSize, want)
+		}
+	}
+}
+
+func TestMerkleStack(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, leafSize := range []abi.PaddedPieceSize{128, 1024} {
+		for _, leaves := range []int{1, 2, 3, 5, 8, 13, 16} {
+			t.Run(fmt.Sprintf("%d leaves of %d bytes", leaves, leafSize), func(t *testing.T) {
+				var s merkleStack
+				var pieces []abi.PieceInfo
+				for i := 0; i < leaves; i++ {
+					var commP commitment
+					rng.Read(commP[:])
+					commP[31] &= 0x3f
+					s.pushLeaf(leafSize, commP)
+					c, err := commP.pieceCID()
+					if err != nil {
+						t.Fatal(err)
+					}
+					pieces = append(pieces, abi.PieceInfo{Size: leafSize, PieceCID: c})
+				}
+				want, err := nonffi.GenerateUnsealedCID(abi.RegisteredSealProof_StackedDrg8MiBV1_1, pieces)
+				if err != nil {
+					t.Fatal(err)
+				}
+				root := s.root()
+				got, err := root.commP.pieceCID()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Equals(want) || s.leaves != leaves {
+					t.Errorf("root %s of %d leaves, expected %s", got, s.leaves, want)
+				}
+				if min := leafSize * abi.PaddedPieceSize(leaves); root.size < min || root.size >= 2*min {
+					t.Errorf("root of %d bytes for %d leaves of %d", root.size, leaves, leafSize)
+				}
+			})
+		}
+	}
+}
+
+// padCID returns the piece CID c of size padded to a piece of to, by PadCommP
+// of go-fil-commp-hashhash
+func padCID(t *testing.T, c cid.Cid, size, to abi.PaddedPieceSize) cid.Cid {
+	t.Helper()
+	commP, err := commcid.CIDToPieceCommitmentV1(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded, err := commp.PadCommP(commP, uint64(size), uint64(to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = commcid.DataCommitmentV1ToCID(padded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,10 @@
+package fastcommp
+
+// SHA256Backend names the SHA-256 implementation used for leaf and tree
+// hashing on this machine. All hashing goes through sha256-simd, which picks
+// the CPU's SHA extensions at startup (SHA-NI on amd64, the ARMv8 SHA2
+// instructions on arm64) and otherwise falls back to the Go standard library,
+// reported as "generic".
+func SHA256Backend() string {
+	return archBackend()
+}
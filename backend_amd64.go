@@ -0,0 +1,16 @@
+package fastcommp
+
+import (
+	"github.com/klauspost/cpuid/v2"
+)
+
+// archBackend mirrors the selection made by sha256-simd on amd64: SHA-NI, or
+// else the Go standard library. Its AVX-512 code only runs behind a 16-lane
+// server that takes a channel round trip per digest, which costs more than
+// hashing the 64-byte node pairs of a piece tree, so it is not used.
+func archBackend() string {
+	if cpuid.CPU.Supports(cpuid.SHA, cpuid.SSSE3, cpuid.SSE4) {
+		return "sha-ni"
+	}
+	return "generic"
+}
@@ -0,0 +1,23 @@
+package fastcommp
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+
+	"github.com/klauspost/cpuid/v2"
+)
+
+// archBackend mirrors the selection made by sha256-simd on arm64, including
+// its /proc/cpuinfo fallback for Linux kernels that hide the feature bits
+func archBackend() string {
+	if cpuid.CPU.Has(cpuid.SHA2) {
+		return "arm64-sha2"
+	}
+	if runtime.GOOS == "linux" {
+		if info, err := os.ReadFile("/proc/cpuinfo"); err == nil && bytes.Contains(info, []byte("sha2")) {
+			return "arm64-sha2"
+		}
+	}
+	return "generic"
+}
@@ -0,0 +1,8 @@
+//go:build !amd64 && !arm64
+
+package fastcommp
+
+// archBackend is always the standard library off amd64 and arm64
+func archBackend() string {
+	return "generic"
+}
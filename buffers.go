@@ -0,0 +1,31 @@
+package fastcommp
+
+import (
+	"sync"
+)
+
+// leafBufs holds a *sync.Pool of leaf buffers per buffer length, shared by
+// every writer in the process so that hashing many payloads in a row reuses
+// leaf memory instead of allocating it per writer
+var leafBufs sync.Map
+
+// getLeafBuf returns a buffer of n bytes from the shared pool. Its contents
+// are undefined.
+func getLeafBuf(n int) []byte {
+	if p, ok := leafBufs.Load(n); ok {
+		if b, ok := p.(*sync.Pool).Get().(*[]byte); ok {
+			return (*b)[:n]
+		}
+	}
+	return make([]byte, n)
+}
+
+// putLeafBuf returns buf to the shared pool. buf must not be used afterwards.
+func putLeafBuf(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+	p, _ := leafBufs.LoadOrStore(cap(buf), new(sync.Pool))
+	buf = buf[:cap(buf)]
+	p.(*sync.Pool).Put(&buf)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// pieceEntry is a piece read by aggregate: an element of a JSON list of
+// pieces, or a record of a manifest
+type pieceEntry struct {
+	PieceCID  string `json:"pieceCid"`
+	PieceSize uint64 `json:"pieceSize"`
+	Size      uint64 `json:"size"`
+	Path      string `json:"path"`
+	Error     string `json:"error"`
+}
+
+// runAggregate computes the piece CID of the aggregate of the pieces listed
+// in PIECES, the CommD of a sector holding them with --sector-size
+func runAggregate(args []string) int {
+	var aopts struct {
+		Help       bool     `getopt:"--help -h display this help"`
+		SectorSize byteSize `getopt:"--sector-size=SIZE aggregate into a sector of SIZE, such as 32GiB, instead of the smallest piece that holds the pieces"`
+		JSON       bool     `getopt:"--json print the aggregate as JSON"`
+		Index      bool     `getopt:"--data-segment-index aggregate into a deal ending with the FRC-0058 data segment index of its pieces"`
+		PieceSize  byteSize `getopt:"--piece-size=SIZE with --data-segment-index, aggregate into a deal of SIZE instead of the smallest that holds the pieces"`
+		IndexOut   string   `getopt:"--index-out=FILE with --data-segment-index, write the index to FILE as it goes in the deal payload"`
+		ProofDir   string   `getopt:"--proof-dir=DIR with --data-segment-index, write the inclusion proof of each piece to DIR/PIECECID.json"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp aggregate")
+	set.SetParameters("PIECES")
+	options.RegisterSet("aggregate", &aopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if aopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 1 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if !aopts.Index && (aopts.PieceSize > 0 || aopts.IndexOut != "" || aopts.ProofDir != "") {
+		fmt.Fprintln(os.Stderr, "Error: --piece-size, --index-out and --proof-dir need --data-segment-index")
+		return exitUsage
+	}
+	if aopts.Index && aopts.SectorSize > 0 {
+		fmt.Fprintln(os.Stderr, "Error: --data-segment-index aggregates into a deal of --piece-size, not a sector")
+		return exitUsage
+	}
+	if aopts.SectorSize > 0 {
+		if _, err := fastcommp.SealProofOf(abi.SectorSize(aopts.SectorSize)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --sector-size %s, expected 2KiB, 8MiB, 512MiB, 32GiB or 64GiB\n", formatSize(int64(aopts.SectorSize)))
+			return exitUsage
+		}
+	}
+
+	pieces, err := readPieces(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitStatus(errorCode(err), exitFailed)
+	}
+	var agg fastcommp.Aggregate
+	if aopts.Index {
+		agg, err = fastcommp.AggregateDeal(abi.PaddedPieceSize(aopts.PieceSize), pieces)
+	} else {
+		agg, err = fastcommp.AggregatePieces(abi.PaddedPieceSize(aopts.SectorSize), pieces)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	if aopts.IndexOut != "" {
+		if err := writeSegmentIndex(aopts.IndexOut, agg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing --index-out %s: %s\n", aopts.IndexOut, err)
+			return exitIO
+		}
+	}
+	if aopts.ProofDir != "" {
+		if err := writeInclusionProofs(aopts.ProofDir, agg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing --proof-dir %s: %s\n", aopts.ProofDir, err)
+			return exitIO
+		}
+	}
+
+	if aopts.JSON {
+		out, _ := json.MarshalIndent(aggregateJSON(agg), "", "  ")
+		fmt.Println(string(out))
+		return exitOK
+	}
+	var size, padding abi.PaddedPieceSize
+	for _, p := range agg.Pieces {
+		size += p.Size
+	}
+	for _, z := range agg.ZeroPieces {
+		padding += z.Size
+	}
+	fmt.Printf("Piece CID:   %s\n", agg.PieceCID)
+	fmt.Printf("Piece size:  %d bytes (%s)\n", agg.PieceSize, formatSize(int64(agg.PieceSize)))
+	fmt.Printf("Pieces:      %d, of %s\n", len(agg.Pieces), formatSize(int64(size)))
+	fmt.Printf("Zero pieces: %d, of %s\n", len(agg.ZeroPieces), formatSize(int64(padding)))
+	if agg.Index != nil {
+		fmt.Printf("Index:       %d entries of %d, at offset %d (%d unpadded)\n", len(agg.Index), fastcommp.MaxSegmentEntries(agg.PieceSize), agg.IndexOffset, agg.IndexOffset.Unpadded())
+	}
+	fmt.Println()
+	type row struct {
+		kind string
+		fastcommp.PlacedPiece
+	}
+	var rows []row
+	for _, p := range agg.Pieces {
+		rows = append(rows, row{"piece", p})
+	}
+	for _, z := range agg.ZeroPieces {
+		rows = append(rows, row{"zero", z})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Offset < rows[j].Offset
+	})
+	for _, r := range rows {
+		fmt.Printf("%-5s %14d %10s %s\n", r.kind, r.Offset, formatSize(int64(r.Size)), r.PieceCID)
+	}
+	if agg.Index != nil {
+		fmt.Printf("index %14d %10s\n", agg.IndexOffset, formatSize(int64(agg.PieceSize-agg.IndexOffset)))
+		for _, e := range agg.Index {
+			fmt.Printf("  entry %14d %10s %s %x\n", e.Offset, formatSize(int64(e.Size)), e.CommDs, e.Checksum)
+		}
+	}
+	return exitOK
+}
+
+// aggregateJSON returns the aggregate for encoding to JSON, with the
+// checksums of its index entries in hex
+func aggregateJSON(agg fastcommp.Aggregate) interface{} {
+	type entry struct {
+		fastcommp.SegmentEntry
+		Checksum string
+	}
+	type aggregate struct {
+		fastcommp.Aggregate
+		Index []entry `json:",omitempty"`
+	}
+	a := aggregate{Aggregate: agg}
+	for _, e := range agg.Index {
+		a.Index = append(a.Index, entry{e, hex.EncodeToString(e.Checksum[:])})
+	}
+	return a
+}
+
+// writeSegmentIndex writes the data segment index of agg to path, to be
+// written into the deal payload at its unpadded offset
+func writeSegmentIndex(path string, agg fastcommp.Aggregate) error {
+	index, err := agg.SegmentIndex()
+	if err != nil {
+		return err
+	}
+	f, err := createAtomic(path, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(index); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// readPieces reads the pieces to aggregate from name, or stdin for -: a JSON
+// list of {"pieceCid", "pieceSize"} objects, a stream of them, or manifests,
+// whose failed records are left out
+func readPieces(name string) ([]abi.PieceInfo, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	zr, err := newDecompressor(compressionOf(name), r)
+	if err != nil {
+		return nil, xerrors.Errorf("reading %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	var entries []pieceEntry
+	dec := json.NewDecoder(zr)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, xerrors.Errorf("reading %s: %w", name, err)
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var list []pieceEntry
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, xerrors.Errorf("reading %s: %w", name, err)
+			}
+			entries = append(entries, list...)
+			continue
+		}
+		var v struct {
+			pieceEntry
+			Files []pieceEntry `json:"files"`
+		}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, xerrors.Errorf("reading %s: %w", name, err)
+		}
+		if v.Files != nil {
+			entries = append(entries, v.Files...)
+		} else {
+			entries = append(entries, v.pieceEntry)
+		}
+	}
+
+	var pieces []abi.PieceInfo
+	for i, e := range entries {
+		if e.Error != "" {
+			continue
+		}
+		c, err := cid.Decode(e.PieceCID)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: piece %d %s: invalid piece CID %q: %w", name, i, e.Path, e.PieceCID, err)
+		}
+		size := e.PieceSize
+		if size == 0 {
+			size = e.Size
+		}
+		pieces = append(pieces, abi.PieceInfo{Size: abi.PaddedPieceSize(size), PieceCID: c})
+	}
+	return pieces, nil
+}
+
+// inclusionFile is the inclusion proof of a piece in an aggregate deal, as
+// written by --proof-dir and read by verify-inclusion
+type inclusionFile struct {
+	AggregateCID  string                   `json:"aggregateCid"`
+	AggregateSize abi.PaddedPieceSize      `json:"aggregateSize"`
+	PieceCID      string                   `json:"pieceCid"`
+	PieceSize     abi.PaddedPieceSize      `json:"pieceSize"`
+	Proof         fastcommp.InclusionProof `json:"proof"`
+}
+
+// writeInclusionProofs writes the inclusion proof of each piece of agg to
+// dir, named by its piece CID. A piece aggregated more than once is proven
+// at its first offset.
+func writeInclusionProofs(dir string, agg fastcommp.Aggregate) error {
+	proofs, err := agg.InclusionProofs()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	written := make(map[cid.Cid]bool, len(proofs))
+	for i, p := range agg.Pieces {
+		if written[p.PieceCID] {
+			continue
+		}
+		written[p.PieceCID] = true
+		data, err := json.MarshalIndent(inclusionFile{
+			AggregateCID:  agg.PieceCID.String(),
+			AggregateSize: agg.PieceSize,
+			PieceCID:      p.PieceCID.String(),
+			PieceSize:     p.Size,
+			Proof:         proofs[i],
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		f, err := createAtomic(filepath.Join(dir, p.PieceCID.String()+".json"), 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			f.abort()
+			return err
+		}
+		if err := f.commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
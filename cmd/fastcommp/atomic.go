@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// atomicFile is written under a temporary name next to path and renamed into
+// place by commit, so that a crashed run never leaves a truncated file behind
+type atomicFile struct {
+	*os.File
+	path string
+	perm os.FileMode
+}
+
+// createAtomic starts writing the file at path, which gets permissions perm
+func createAtomic(path string, perm os.FileMode) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path, perm: perm}, nil
+}
+
+// commit flushes the file to disk and moves it to its path, replacing any
+// previous version
+func (f *atomicFile) commit() error {
+	if err := f.Sync(); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), f.perm); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// abort discards the file, leaving any previous version in place
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"golang.org/x/xerrors"
+)
+
+// azureCredential is the default Azure credential chain: environment,
+// workload and managed identity, and the Azure CLI login
+var azureCredential = sync.OnceValues(func() (azcore.TokenCredential, error) {
+	return azidentity.NewDefaultAzureCredential(nil)
+})
+
+// azureClients caches one *azblob.Client per storage account
+var azureClients sync.Map
+
+// openAzure streams the blob az://account/container/blob
+func openAzure(u *url.URL) (input, error) {
+	account := u.Host
+	container, blob, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if account == "" || container == "" || blob == "" {
+		return input{}, xerrors.Errorf("invalid Azure URL %s, expected az://account/container/blob", u)
+	}
+
+	client, err := azureClient(account)
+	if err != nil {
+		return input{}, err
+	}
+	resp, err := client.DownloadStream(context.Background(), container, blob, nil)
+	if err != nil {
+		return input{}, xerrors.Errorf("downloading %s: %w", u, err)
+	}
+	in := input{
+		ReadCloser: resp.Body,
+		size:       -1,
+		resume: func(off int64) (io.ReadCloser, error) {
+			resp, err := client.DownloadStream(context.Background(), container, blob, &azblob.DownloadStreamOptions{
+				Range: azblob.HTTPRange{Offset: off},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return resp.Body, nil
+		},
+	}
+	if resp.ContentLength != nil {
+		in.size = *resp.ContentLength
+	}
+	return in, nil
+}
+
+// azureClient returns the blob client of account
+func azureClient(account string) (*azblob.Client, error) {
+	if c, ok := azureClients.Load(account); ok {
+		return c.(*azblob.Client), nil
+	}
+
+	cred, err := azureCredential()
+	if err != nil {
+		return nil, xerrors.Errorf("loading Azure credentials: %w", err)
+	}
+	c, err := azblob.NewClient("https://"+account+".blob.core.windows.net/", cred, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("creating Azure client for account %s: %w", account, err)
+	}
+	actual, _ := azureClients.LoadOrStore(account, c)
+	return actual.(*azblob.Client), nil
+}
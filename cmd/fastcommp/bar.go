@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// barInterval is how often the progress bar is redrawn
+const barInterval = 200 * time.Millisecond
+
+// barWidth is the number of cells of each bar
+const barWidth = 20
+
+// progressBar draws the progress of the inputs in flight and, for a batch,
+// of the whole batch below them, at the bottom of the terminal on stderr
+type progressBar struct {
+	mu  sync.Mutex
+	tty *os.File
+	// lines is the number of lines drawn, erased before anything else is
+	// written to the terminal
+	lines int
+
+	// batch is the progress of the whole batch, nil for a single input
+	batch *batchProgress
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// bar is the progress bar of the run, nil when none is drawn
+var bar *progressBar
+
+// startProgressBar starts drawing the progress of hashing inputs when stderr
+// is a terminal, unless --quiet is given. The terminal writers are wrapped so
+// that their output goes above the bar.
+func startProgressBar(inputs []string, batch bool) {
+	if opts.Quiet || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return
+	}
+	b := &progressBar{
+		tty:     os.Stderr,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if batch {
+		batchStatus = newBatchProgress(inputs)
+		b.batch = batchStatus
+	}
+
+	bar = b
+	stdout, info, stderr = b.wrap(stdout), b.wrap(info), b.wrap(stderr)
+	go b.run()
+}
+
+// stopProgressBar erases the progress bar for good
+func stopProgressBar() {
+	if bar == nil {
+		return
+	}
+	close(bar.stop)
+	<-bar.stopped
+}
+
+func (b *progressBar) run() {
+	defer close(b.stopped)
+	t := time.NewTicker(barInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.redraw()
+		case <-b.stop:
+			b.mu.Lock()
+			b.erase()
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// redraw replaces the lines drawn last with the current progress
+func (b *progressBar) redraw() {
+	width, height, err := term.GetSize(int(b.tty.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	var lines []string
+	var hashed int64
+	running.Lock()
+	for _, j := range running.jobs {
+		n := j.progress()
+		hashed += n
+		lines = append(lines, barLine(j.path, n, j.size, time.Since(j.start), width))
+	}
+	running.Unlock()
+	// keep the batch line and a line of output in view
+	if max := height - 2; len(lines) > max && max > 0 {
+		more := len(lines) - max + 1
+		lines = append(lines[:max-1], fmt.Sprintf("... and %d more", more))
+	}
+	if b.batch != nil {
+		s := b.batch.snapshot()
+		label := fmt.Sprintf("%d/%d files", s.finished, s.files)
+		lines = append(lines, barLine(label, s.done+hashed, s.total, time.Since(s.start), width))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.erase()
+	fmt.Fprint(b.tty, strings.Join(lines, "\n"))
+	b.lines = len(lines)
+}
+
+// erase clears the lines drawn, leaving the cursor where the first one was
+func (b *progressBar) erase() {
+	if b.lines == 0 {
+		return
+	}
+	fmt.Fprint(b.tty, "\r\033[K"+strings.Repeat("\033[A\033[K", b.lines-1))
+	b.lines = 0
+}
+
+// barLine describes n bytes of size hashed in elapsed, labelled with label
+// cut to fit in width. Without a known size it has no bar and no ETA.
+func barLine(label string, n, size int64, elapsed time.Duration, width int) string {
+	s := " " + formatSize(n)
+	if size > 0 {
+		if n > size {
+			n = size
+		}
+		cells := int(n * barWidth / size)
+		s = fmt.Sprintf(" [%s%s] %5.1f%% %s/%s", strings.Repeat("=", cells), strings.Repeat(" ", barWidth-cells),
+			float64(n)*100/float64(size), formatSize(n), formatSize(size))
+	}
+	s += "  " + throughput(n, elapsed)
+	if rate := float64(n) / elapsed.Seconds(); size > 0 && rate > 0 {
+		eta := time.Duration(float64(size-n) / rate * float64(time.Second))
+		s += fmt.Sprintf("  ETA %s", eta.Round(time.Second))
+	}
+
+	if room := width - len(s) - 1; len(label) > room {
+		if room > 3 {
+			label = "..." + label[len(label)-room+3:]
+		} else {
+			label = ""
+		}
+	}
+	return label + s
+}
+
+// wrap returns w, or if w is a terminal a writer that erases the bar before
+// each write, to redraw it below the output
+func (b *progressBar) wrap(w io.Writer) io.Writer {
+	if f, ok := w.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		return w
+	}
+	return barWriter{b, w}
+}
+
+// barWriter writes to a terminal that shows a progress bar
+type barWriter struct {
+	b *progressBar
+	w io.Writer
+}
+
+func (w barWriter) Write(p []byte) (int, error) {
+	w.b.mu.Lock()
+	defer w.b.mu.Unlock()
+	w.b.erase()
+	return w.w.Write(p)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// xattrPrefix starts the names of the extended attributes of --xattr
+const xattrPrefix = "user.fastcommp."
+
+// wholeFile reports whether inputs are hashed whole, so that their results
+// can be stored with them and reused
+func wholeFile() bool {
+	return opts.Offset == 0 && opts.Length < 0
+}
+
+// decompressed reports whether the payload hashed for the input called name
+// is its decompressed content rather than its bytes as stored
+func decompressed(name string) bool {
+	return opts.Decompress || compressionOf(name) != formatNone
+}
+
+// fingerprint identifies the version of the file called name, described by
+// fi, that a stored result was calculated from, and whether it was
+// decompressed
+func fingerprint(name string, fi os.FileInfo) string {
+	if decompressed(name) {
+		return fmt.Sprintf("%d:%d:decompressed", fi.Size(), fi.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%d:%d", fi.Size(), fi.ModTime().UnixNano())
+}
+
+// cachedSum returns the sum stored with --xattr or --sidecar for the input
+// called name, described by fi, if it is still fresh and --force is not given
+func cachedSum(name string, fi os.FileInfo, writerOpts []fastcommp.Option) (fastcommp.DataCIDSize, bool) {
+	if opts.Force || fi == nil || !wholeFile() {
+		return fastcommp.DataCIDSize{}, false
+	}
+	if opts.Xattr {
+		if sum, err := readXattrs(name, fi, writerOpts); err == nil {
+			return sum, true
+		}
+	}
+	if opts.Sidecar {
+		if sum, err := readSidecar(name, fi, writerOpts); err == nil {
+			return sum, true
+		}
+	}
+	return fastcommp.DataCIDSize{}, false
+}
+
+// storeSum stores the sum of the input called name, described by fi, in its
+// extended attributes with --xattr and in its sidecar with --sidecar. A
+// cached sum is only stored where it is missing or stale, and filesystems
+// without extended attributes are skipped.
+func storeSum(name string, fi os.FileInfo, sum fastcommp.DataCIDSize, cached bool) error {
+	if fi == nil || !wholeFile() {
+		return nil
+	}
+	if opts.Xattr {
+		if _, err := readXattrs(name, fi, nil); !cached || err != nil {
+			if err := writeXattrs(name, fi, sum); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+				return xerrors.Errorf("writing extended attributes: %w", err)
+			}
+		}
+	}
+	if opts.Sidecar {
+		if _, err := readSidecar(name, fi, nil); cached && err == nil {
+			return nil
+		}
+		if err := writeSidecar(name, fi, sum); err != nil {
+			return xerrors.Errorf("writing sidecar: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeXattrs stores the v1 piece CID and sizes of sum in the extended
+// attributes of the file called name, with the fingerprint of fi
+func writeXattrs(name string, fi os.FileInfo, sum fastcommp.DataCIDSize) error {
+	// the fingerprint goes last, so that an update cut short leaves the
+	// stale one in place rather than vouching for a half-written result
+	attrs := [][2]string{
+		{"piececid", sum.PieceCID.String()},
+		{"piecesize", strconv.FormatUint(uint64(sum.PieceSize), 10)},
+		{"payloadsize", strconv.FormatInt(sum.PayloadSize, 10)},
+		{"fingerprint", fingerprint(name, fi)},
+	}
+	for _, attr := range attrs {
+		if err := setxattr(name, xattrPrefix+attr[0], []byte(attr[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readXattrs returns the sum stored in the extended attributes of the file
+// called name, unless their fingerprint does not match fi
+func readXattrs(name string, fi os.FileInfo, writerOpts []fastcommp.Option) (fastcommp.DataCIDSize, error) {
+	attr := func(a string) string {
+		v, err := getxattr(name, xattrPrefix+a)
+		if err != nil {
+			return ""
+		}
+		return string(v)
+	}
+	if attr("fingerprint") != fingerprint(name, fi) {
+		return fastcommp.DataCIDSize{}, xerrors.New("stale or missing fingerprint")
+	}
+	pieceCID, err := cid.Decode(attr("piececid"))
+	if err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	pieceSize, err := strconv.ParseUint(attr("piecesize"), 10, 64)
+	if err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	payloadSize, err := strconv.ParseInt(attr("payloadsize"), 10, 64)
+	if err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	return fastcommp.NewDataCIDSize(pieceCID, payloadSize, abi.PaddedPieceSize(pieceSize), writerOpts...)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/application-research/fastcommp"
+)
+
+// saveOpts restores the command-line options when t ends
+func saveOpts(t *testing.T) {
+	saved := opts
+	t.Cleanup(func() { opts = saved })
+}
+
+// sumOf returns the v1 piece CID of payload
+func sumOf(t *testing.T, payload []byte) cid.Cid {
+	t.Helper()
+	sum, err := fastcommp.SumBytes(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum.PieceCID
+}
+
+func TestCachedResults(t *testing.T) {
+	saveOpts(t)
+	payload := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(payload)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(payload)
+	zw.Close()
+
+	// a gzip file without a .gz name is only decompressed with --decompress
+	path := filepath.Join(t.TempDir(), "payload.bin")
+	if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	raw, decompressed := sumOf(t, compressed.Bytes()), sumOf(t, payload)
+
+	opts.Sidecar = true
+	for i, tc := range []struct {
+		name   string
+		set    func()
+		want   cid.Cid
+		cached bool
+	}{
+		{"first run", func() {}, raw, false},
+		{"unchanged", func() {}, raw, true},
+		{"--decompress", func() { opts.Decompress = true }, decompressed, false},
+		{"unchanged with --decompress", func() {}, decompressed, true},
+		{"without --decompress", func() { opts.Decompress = false }, raw, false},
+		{"--force", func() { opts.Force = true }, raw, false},
+		{"modified", func() {
+			opts.Force = false
+			mtime := time.Now().Add(time.Hour)
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}, raw, false},
+		{"unchanged after modification", func() {}, raw, true},
+	} {
+		tc.set()
+		res, err := hashInput(context.Background(), path, nil)
+		if err != nil {
+			t.Fatalf("%d %s: %s", i, tc.name, err)
+		}
+		if !res.PieceCID.Equals(tc.want) || res.Cached != tc.cached {
+			t.Errorf("%s: %s, cached %t, expected %s, cached %t", tc.name, res.PieceCID, res.Cached, tc.want, tc.cached)
+		}
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	saveOpts(t)
+	payload := make([]byte, 5000)
+	rand.New(rand.NewSource(2)).Read(payload)
+	path := filepath.Join(t.TempDir(), "payload.bin")
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fastcommp.SumBytes(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeXattrs(path, fi, sum); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("no extended attributes in", filepath.Dir(path))
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := getxattr(path, xattrPrefix+"piececid"); err != nil || string(v) != sum.PieceCID.String() {
+		t.Errorf("%spiececid is %q, %v", xattrPrefix, v, err)
+	}
+	got, err := readXattrs(path, fi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameSum(got, sum) {
+		t.Errorf("read back %+v, want %+v", got, sum)
+	}
+
+	// a changed file, or one hashed differently, makes them stale
+	opts.Decompress = true
+	if _, err := readXattrs(path, fi, nil); err == nil {
+		t.Error("attributes of the stored bytes read back with --decompress")
+	}
+	opts.Decompress = false
+	mtime := fi.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	touched, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readXattrs(path, touched, nil); err == nil {
+		t.Error("attributes read back after the mtime changed")
+	}
+
+	// a run with --xattr refreshes them, and the next one reuses them
+	opts.Xattr = true
+	for _, cached := range []bool{false, true} {
+		res, err := hashInput(context.Background(), path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.PieceCID.Equals(sum.PieceCID) || res.Cached != cached {
+			t.Errorf("%s, cached %t, expected %s, cached %t", res.PieceCID, res.Cached, sum.PieceCID, cached)
+		}
+	}
+}
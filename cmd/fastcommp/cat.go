@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// hashConcat hashes the inputs called names back to back as one payload. The
+// inputs are opened one at a time, as the previous one is exhausted.
+func hashConcat(ctx context.Context, names []string, writerOpts []fastcommp.Option) (result, error) {
+	path := strings.Join(names, " ")
+	return withTimeout(ctx, path, func(ctx context.Context) (result, error) {
+		in := input{ReadCloser: &catReader{names: names}, size: -1}
+		return hashPayload(ctx, path, in, writerOpts)
+	})
+}
+
+// catReader reads the concatenation of the inputs called names
+type catReader struct {
+	names []string
+	cur   input
+	name  string
+	// n is the number of bytes read from cur
+	n int64
+}
+
+func (r *catReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur.ReadCloser == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+			r.name, r.names = r.names[0], r.names[1:]
+			in, err := openPayload(r.name)
+			if err != nil {
+				return 0, xerrors.Errorf("opening %s: %w", r.name, err)
+			}
+			r.cur, r.n = in, 0
+		}
+
+		n, err := r.cur.Read(p)
+		r.n += int64(n)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur.ReadCloser = nil
+			if r.cur.size >= 0 && r.n != r.cur.size {
+				return n, xerrors.Errorf("read %d bytes of %s, but the input announced %d", r.n, r.name, r.cur.size)
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			if err != nil {
+				err = xerrors.Errorf("reading %s: %w", r.name, err)
+			}
+			return n, err
+		}
+	}
+}
+
+func (r *catReader) Close() error {
+	if r.cur.ReadCloser == nil {
+		return nil
+	}
+	return r.cur.Close()
+}
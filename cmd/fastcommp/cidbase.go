@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/pborman/getopt/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// cidBase is the multibase the printed CIDs are encoded in, such as base32
+// (the default for CIDv1), base58btc or base16
+type cidBase struct {
+	name string
+	enc  multibase.Encoder
+}
+
+func (b *cidBase) Set(value string, _ getopt.Option) error {
+	enc, err := multibase.EncoderByName(value)
+	if err != nil {
+		return xerrors.Errorf("unknown multibase %q, such as base32, base58btc or base16", value)
+	}
+	b.name, b.enc = value, enc
+	return nil
+}
+
+func (b *cidBase) String() string {
+	return b.name
+}
+
+// set reports whether --cid-base was given
+func (b *cidBase) set() bool {
+	return b.name != ""
+}
+
+// format returns the string form of c in the base
+func (b *cidBase) format(c cid.Cid) string {
+	if !b.set() || !c.Defined() {
+		return c.String()
+	}
+	return c.Encode(b.enc)
+}
+
+// cidLink marshals a CID to JSON like cid.Cid does, as {"/": "<cid>"}, but
+// in the --cid-base
+type cidLink cid.Cid
+
+func (c cidLink) String() string {
+	return opts.CIDBase.format(cid.Cid(c))
+}
+
+func (c cidLink) MarshalJSON() ([]byte, error) {
+	if !cid.Cid(c).Defined() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(map[string]string{"/": opts.CIDBase.format(cid.Cid(c))})
+}
+
+// sumJSON returns the sum of res for encoding to JSON, led by its
+// SchemaVersion like the records of a batch, with the fields added by
+// finishResult and its piece CID in the --cid-base
+func sumJSON(res result) interface{} {
+	type sum struct {
+		SchemaVersion int
+		fastcommp.DataCIDSize
+		PieceCIDv2    *cidLink `json:",omitempty"`
+		CommitmentHex string
+		MultihashHex  string
+		Stat          *fileStat `json:",omitempty"`
+		Cached        bool      `json:",omitempty"`
+		PiecePath     string    `json:",omitempty"`
+	}
+	s := sum{schemaVersion, res.DataCIDSize, res.PieceCIDv2, res.CommitmentHex, res.MultihashHex, res.Stat, res.Cached, res.PiecePath}
+	if !opts.CIDBase.set() {
+		return s
+	}
+	return struct {
+		sum
+		PieceCID cidLink
+	}{s, cidLink(res.PieceCID)}
+}
+
+// MarshalJSON encodes the record, led by its SchemaVersion, with its piece
+// CID in the --cid-base. The field is only replaced when one is given, to
+// keep the field order of the default output.
+func (res result) MarshalJSON() ([]byte, error) {
+	type plain result
+	type versioned struct {
+		SchemaVersion int
+		plain
+	}
+	v := versioned{schemaVersion, plain(res)}
+	if !opts.CIDBase.set() {
+		return json.Marshal(v)
+	}
+	return json.Marshal(struct {
+		versioned
+		PieceCID cidLink
+	}{v, cidLink(res.PieceCID)})
+}
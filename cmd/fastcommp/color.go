@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// SGR codes of the colors of the human output
+const (
+	colorBold   = "1"
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorCyan   = "36"
+)
+
+// colorInfo and colorErr tell whether info and stderr are colored: when they
+// are terminals, unless --no-color or NO_COLOR say otherwise. The records
+// are never colored.
+var colorInfo, colorErr bool
+
+// setupColor decides on the colors of info and stderr
+func setupColor() {
+	colorInfo, colorErr = useColor(info), useColor(os.Stderr)
+}
+
+// useColor reports whether output to w may be colored
+func useColor(w io.Writer) bool {
+	if opts.NoColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// paint wraps s in the SGR codes if on
+func paint(on bool, s string, codes ...string) string {
+	if !on || len(codes) == 0 {
+		return s
+	}
+	seq := "\033[" + codes[0]
+	for _, c := range codes[1:] {
+		seq += ";" + c
+	}
+	return seq + "m" + s + "\033[0m"
+}
+
+// warnf prints a warning to stderr
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintf(stderr, "%s %s\n", paint(colorErr, "warning:", colorYellow), fmt.Sprintf(format, args...))
+}
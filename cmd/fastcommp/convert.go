@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+)
+
+// fr32Sha256Trunc254Padbintree is the multihash of FIP-0069 piece CIDs v2,
+// whose digest is the padding, the tree height and the commitment
+const fr32Sha256Trunc254Padbintree = 0x1011
+
+// convertForms are the forms convert prints a commitment in, in order
+var convertForms = []string{"cid", "hex", "base64", "multihash"}
+
+// runConvert converts piece commitments between piece CIDs, raw commitments
+// in hex or base64 and multihashes, detecting the form of each VALUE
+func runConvert(args []string) int {
+	var copts struct {
+		Help    bool    `getopt:"--help -h display this help"`
+		To      string  `getopt:"--to=FORM print only the FORM of each VALUE: cid, hex, base64 or multihash"`
+		CIDBase cidBase `getopt:"--cid-base=BASE encode the piece CID in the multibase BASE, such as base32 or base58btc"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp convert")
+	set.SetParameters("VALUE ...")
+	options.RegisterSet("convert", &copts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if copts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) == 0 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	copts.To = strings.ToLower(copts.To)
+	if copts.To != "" && !contains(convertForms, copts.To) {
+		fmt.Fprintf(os.Stderr, "Error: unknown --to %q, expected %s\n", copts.To, strings.Join(convertForms, ", "))
+		return exitUsage
+	}
+
+	status := exitOK
+	for i, arg := range args {
+		commP, err := parseCommitment(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			status = exitFailed
+			continue
+		}
+		forms, err := commitmentForms(commP, &copts.CIDBase)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", arg, err)
+			status = exitFailed
+			continue
+		}
+		if copts.To != "" {
+			fmt.Println(forms[copts.To])
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		for _, form := range convertForms {
+			fmt.Printf("%-10s %s\n", form+":", forms[form])
+		}
+	}
+	return status
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// commitmentForms returns commP in each of the convertForms
+func commitmentForms(commP []byte, base *cidBase) (map[string]string, error) {
+	c, err := commcid.PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"cid":       base.format(c),
+		"hex":       hex.EncodeToString(commP),
+		"base64":    base64.StdEncoding.EncodeToString(commP),
+		"multihash": hex.EncodeToString(c.Hash()),
+	}, nil
+}
+
+// parseCommitment returns the raw commitment in s: a piece CID v1 or v2, or
+// a raw commitment or its multihash in hex or base64
+func parseCommitment(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if c, err := cid.Decode(s); err == nil {
+		return pieceCommitment(c)
+	}
+
+	var data []byte
+	if b, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x")); err == nil {
+		data = b
+	} else if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		data = b
+	} else if b, err := base64.URLEncoding.DecodeString(s); err == nil {
+		data = b
+	} else {
+		return nil, xerrors.Errorf("%s is not a piece CID, nor a commitment or multihash in hex or base64", s)
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	commP, err := multihashCommitment(data)
+	if err != nil {
+		return nil, xerrors.Errorf("%s is %d bytes, neither a 32-byte commitment nor its multihash: %w", s, len(data), err)
+	}
+	return commP, nil
+}
+
+// pieceCommitment returns the raw commitment of a piece CID v1 or v2
+func pieceCommitment(c cid.Cid) ([]byte, error) {
+	commP, err := multihashCommitment(c.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("%s is not a piece CID: %w", c, err)
+	}
+	return commP, nil
+}
+
+// multihashCommitment returns the raw commitment of the multihash of a piece
+// CID v1 or v2
+func multihashCommitment(mh []byte) ([]byte, error) {
+	dm, err := multihash.Decode(mh)
+	if err != nil {
+		return nil, err
+	}
+	switch dm.Code {
+	case multihash.SHA2_256_TRUNC254_PADDED:
+		if dm.Length != 32 {
+			return nil, xerrors.Errorf("digest is %d bytes, expected 32", dm.Length)
+		}
+		return dm.Digest, nil
+	case fr32Sha256Trunc254Padbintree:
+		_, _, commP, err := splitPieceDigest(dm.Digest)
+		return commP, err
+	}
+	return nil, xerrors.Errorf("multihash 0x%x is not a piece commitment", dm.Code)
+}
+
+// splitPieceDigest splits the digest of a piece CID v2 into its padding,
+// tree height and commitment
+func splitPieceDigest(digest []byte) (padding uint64, height int, commP []byte, err error) {
+	padding, n := binary.Uvarint(digest)
+	if n <= 0 || len(digest) != n+1+32 {
+		return 0, 0, nil, xerrors.Errorf("invalid piece CID v2 digest of %d bytes", len(digest))
+	}
+	return padding, int(digest[n]), digest[n+1:], nil
+}
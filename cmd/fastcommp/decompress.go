@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/xerrors"
+)
+
+// compression formats recognized by decompressInput
+const (
+	formatNone = ""
+	formatGzip = "gzip"
+	formatZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressionOf returns the compression format implied by the extension of
+// the input called name
+func compressionOf(name string) string {
+	if u, ok := sourceURL(name); ok {
+		name = u.Path
+	}
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gz", ".tgz":
+		return formatGzip
+	case ".zst", ".tzst":
+		return formatZstd
+	}
+	return formatNone
+}
+
+// decompressInput wraps in with a decompressor when name ends in .gz or .zst,
+// or, with --decompress, when its leading bytes identify it as gzip or zstd,
+// so that the uncompressed payload is hashed. The size of a decompressed
+// input is unknown.
+func decompressInput(name string, in input) (input, error) {
+	format := compressionOf(name)
+	if format == formatNone && !opts.Decompress {
+		return in, nil
+	}
+
+	br := bufio.NewReader(in.ReadCloser)
+	if format == formatNone {
+		magic, _ := br.Peek(len(zstdMagic))
+		switch {
+		case bytes.HasPrefix(magic, gzipMagic):
+			format = formatGzip
+		case bytes.HasPrefix(magic, zstdMagic):
+			format = formatZstd
+		default:
+			return input{}, xerrors.New("input is neither gzip nor zstd compressed")
+		}
+	}
+
+	dec, err := newDecompressor(format, br)
+	if err != nil {
+		return input{}, err
+	}
+	return input{
+		ReadCloser: decompressedReader{ReadCloser: dec, src: in.ReadCloser},
+		size:       -1,
+		stat:       in.stat,
+	}, nil
+}
+
+// newDecompressor returns the payload of r, compressed in format
+func newDecompressor(format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case formatGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, xerrors.Errorf("opening gzip stream: %w", err)
+		}
+		return zr, nil
+	case formatZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, xerrors.Errorf("opening zstd stream: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// compressBytes compresses data in format, as a single gzip member or zstd
+// frame, which may be appended to others
+func compressBytes(format string, data []byte) ([]byte, error) {
+	switch format {
+	case formatGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case formatZstd:
+		zw, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer zw.Close()
+		return zw.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// decompressedReader reads a decompressed stream and closes its source too
+type decompressedReader struct {
+	io.ReadCloser
+	src io.Closer
+}
+
+func (r decompressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if serr := r.src.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
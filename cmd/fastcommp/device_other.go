@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// deviceSize returns the size of the block device f in bytes, found by
+// seeking to its end
+func deviceSize(f *os.File) (int64, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+)
+
+// change is a difference between two manifests, printed by diff
+type change struct {
+	Change      string `json:"change"` // added, removed or changed
+	Path        string `json:"path"`
+	PieceCID    string `json:"pieceCid,omitempty"`
+	OldPieceCID string `json:"oldPieceCid,omitempty"`
+}
+
+// runDiff compares the piece CIDs of the manifests OLD and NEW by path, for
+// incremental onboarding. Like diff(1) it exits with 1 when they differ.
+func runDiff(args []string) int {
+	var dopts struct {
+		Help  bool `getopt:"--help -h display this help"`
+		JSONL bool `getopt:"--jsonl print each change as a JSON object per line"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp diff")
+	set.SetParameters("OLD NEW")
+	options.RegisterSet("diff", &dopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if dopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 2 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+
+	var pieces [2]map[string]string
+	for i, name := range args {
+		records, err := readRecords(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitStatus(errorCode(err), exitFailed)
+		}
+		pieces[i] = piecesByPath(records)
+	}
+	changes := diffPieces(pieces[0], pieces[1])
+
+	var added, removed, changed int
+	for _, c := range changes {
+		switch c.Change {
+		case "added":
+			added++
+		case "removed":
+			removed++
+		case "changed":
+			changed++
+		}
+		if dopts.JSONL {
+			line, _ := json.Marshal(c)
+			fmt.Println(string(line))
+			continue
+		}
+		switch c.Change {
+		case "added":
+			fmt.Printf("+ %s %s\n", c.Path, c.PieceCID)
+		case "removed":
+			fmt.Printf("- %s %s\n", c.Path, c.OldPieceCID)
+		case "changed":
+			fmt.Printf("~ %s %s -> %s\n", c.Path, c.OldPieceCID, c.PieceCID)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d added, %d removed, %d changed\n", added, removed, changed)
+	if len(changes) > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// readRecords reads the records of a --manifest, or of a stream of JSON
+// records such as --output-format jsonl prints
+func readRecords(name string) ([]flatRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return decodeRecords(f, name)
+}
+
+// decodeRecords decodes the records read from r, the file called name: any
+// sequence of manifests and records, such as an --append-manifest appended
+// to since it was compacted, compressed if name ends in .gz or .zst
+func decodeRecords(r io.Reader, name string) ([]flatRecord, error) {
+	zr, err := newDecompressor(compressionOf(name), r)
+	if err != nil {
+		return nil, xerrors.Errorf("reading %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	var records []flatRecord
+	dec := json.NewDecoder(zr)
+	for {
+		var v struct {
+			flatRecord
+			Files []flatRecord `json:"files"`
+		}
+		if err := dec.Decode(&v); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, xerrors.Errorf("reading %s: %w", name, err)
+		}
+		if v.Files != nil {
+			records = append(records, v.Files...)
+		} else {
+			records = append(records, v.flatRecord)
+		}
+	}
+}
+
+// piecesByPath maps the path of each successful record to its piece CID.
+// Failed records have none, and are left out.
+func piecesByPath(records []flatRecord) map[string]string {
+	pieces := make(map[string]string, len(records))
+	for _, rec := range records {
+		if rec.Error == "" && rec.PieceCID != "" {
+			pieces[rec.Path] = rec.PieceCID
+		}
+	}
+	return pieces
+}
+
+// diffPieces returns the changes from old to new, sorted by path. Piece CIDs
+// are compared as CIDs, whatever the --cid-base they were printed in.
+func diffPieces(old, new map[string]string) []change {
+	var changes []change
+	for path, c := range new {
+		o, ok := old[path]
+		switch {
+		case !ok:
+			changes = append(changes, change{Change: "added", Path: path, PieceCID: c})
+		case !sameCID(o, c):
+			changes = append(changes, change{Change: "changed", Path: path, PieceCID: c, OldPieceCID: o})
+		}
+	}
+	for path, o := range old {
+		if _, ok := new[path]; !ok {
+			changes = append(changes, change{Change: "removed", Path: path, OldPieceCID: o})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// sameCID reports whether a and b are the same CID, falling back to
+// comparing them as strings when either does not parse
+func sameCID(a, b string) bool {
+	ca, erra := cid.Decode(a)
+	cb, errb := cid.Decode(b)
+	if erra != nil || errb != nil {
+		return a == b
+	}
+	return ca.Equals(cb)
+}
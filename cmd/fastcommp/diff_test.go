@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadRecords(t *testing.T) {
+	completed := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	records := []flatRecord{
+		{Version: schemaVersion, Path: "a.bin", PayloadSize: 1000, PieceSize: 1024, PieceCID: "baga-a", Completed: completed},
+		{Version: schemaVersion, Path: "b.bin", PayloadSize: 2000, PieceSize: 2048, PieceCID: "baga-b", Completed: completed,
+			FlatStat: &FlatStat{FileSize: 2000, Mtime: completed.Add(-time.Hour), Mode: "-rw-r--r--", Inode: 42}},
+	}
+	appended := flatRecord{Version: schemaVersion, Path: "c.bin", Error: "opening input: missing", ErrorCode: codeNotFound, Completed: completed}
+
+	for _, name := range []string{"manifest.json", "manifest.json.gz", "manifest.json.zst"} {
+		// a compacted manifest followed by the records appended since
+		path := filepath.Join(t.TempDir(), name)
+		if err := writeManifest(path, records, summary{files: 2}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := appendRecord(path, appended); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readRecords(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if want := append(records[:2:2], appended); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func TestDiffPieces(t *testing.T) {
+	old := piecesByPath([]flatRecord{
+		{Path: "same", PieceCID: "baga-1"},
+		{Path: "changed", PieceCID: "baga-2"},
+		{Path: "removed", PieceCID: "baga-3"},
+		{Path: "failed", Error: "boom"},
+	})
+	new := piecesByPath([]flatRecord{
+		{Path: "same", PieceCID: "baga-1"},
+		{Path: "changed", PieceCID: "baga-4"},
+		{Path: "added", PieceCID: "baga-5"},
+	})
+	want := []change{
+		{Change: "added", Path: "added", PieceCID: "baga-5"},
+		{Change: "changed", Path: "changed", PieceCID: "baga-4", OldPieceCID: "baga-2"},
+		{Change: "removed", Path: "removed", OldPieceCID: "baga-3"},
+	}
+	if got := diffPieces(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// directAlign is the buffer, length and offset alignment of O_DIRECT reads
+const directAlign = 4096
+
+// openFile opens the local file called name, with O_DIRECT if --direct-io is
+// set and the filesystem supports it. The returned reader is f itself or a
+// directFile reading f.
+func openFile(name string) (*os.File, io.ReadCloser, error) {
+	if opts.DirectIO {
+		if f, err := os.OpenFile(name, os.O_RDONLY|unix.O_DIRECT, 0); err == nil {
+			return f, &directFile{f: f, direct: true}, nil
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+// adviseSequential tells the kernel that f is read once from start to end,
+// so it reads ahead aggressively
+func adviseSequential(f *os.File) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+// dropCacheEvery is the number of bytes read between cache drops
+const dropCacheEvery = 64 << 20
+
+// cacheDropper reads a local file and evicts the pages it has read from the
+// page cache as it goes, so hashing a large file does not push out the cache
+// of everything else on the machine
+type cacheDropper struct {
+	r io.Reader
+	f *os.File
+	// from is the offset of the first page not yet dropped, n the number of
+	// bytes read past it
+	from, n int64
+}
+
+func newCacheDropper(r io.Reader, f *os.File) *cacheDropper {
+	from, _ := f.Seek(0, io.SeekCurrent)
+	return &cacheDropper{r: r, f: f, from: from}
+}
+
+func (c *cacheDropper) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n >= dropCacheEvery || err != nil {
+		_ = unix.Fadvise(int(c.f.Fd()), c.from, c.n, unix.FADV_DONTNEED)
+		c.from += c.n
+		c.n = 0
+	}
+	return n, err
+}
+
+// directFile reads a file opened with O_DIRECT, bypassing the page cache.
+// Reads into aligned buffers go straight to the caller; others are staged
+// through an aligned buffer of its own. If the kernel rejects a read, for
+// instance after a seek to an unaligned offset, O_DIRECT is turned off.
+type directFile struct {
+	f      *os.File
+	direct bool
+	buf    []byte
+	// pending is the part of buf not handed out yet
+	pending []byte
+}
+
+func (d *directFile) Read(p []byte) (int, error) {
+	if len(d.pending) == 0 {
+		// read whole aligned blocks straight into p
+		if n := len(p) &^ (directAlign - 1); n > 0 && aligned(p) {
+			return d.read(p[:n])
+		}
+		if d.buf == nil {
+			d.buf = alignedBuf(1 << 20)
+		}
+		n, err := d.read(d.buf)
+		d.pending = d.buf[:n]
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// read reads from the file into p, dropping O_DIRECT if the kernel refuses it
+func (d *directFile) read(p []byte) (int, error) {
+	n, err := d.f.Read(p)
+	if d.direct && n == 0 && isEINVAL(err) {
+		d.direct = false
+		if flags, ferr := unix.FcntlInt(d.f.Fd(), unix.F_GETFL, 0); ferr == nil {
+			if _, ferr = unix.FcntlInt(d.f.Fd(), unix.F_SETFL, flags&^unix.O_DIRECT); ferr == nil {
+				return d.f.Read(p)
+			}
+		}
+	}
+	return n, err
+}
+
+func (d *directFile) Seek(off int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		off -= int64(len(d.pending))
+	}
+	d.pending = nil
+	return d.f.Seek(off, whence)
+}
+
+func (d *directFile) Close() error {
+	return d.f.Close()
+}
+
+// aligned reports whether p starts on a directAlign boundary
+func aligned(p []byte) bool {
+	return uintptr(unsafe.Pointer(&p[0]))%directAlign == 0
+}
+
+// alignedBuf allocates n bytes starting on a directAlign boundary
+func alignedBuf(n int) []byte {
+	buf := make([]byte, n+directAlign)
+	skip := int(directAlign - uintptr(unsafe.Pointer(&buf[0]))%directAlign)
+	return buf[skip%directAlign:][:n:n]
+}
+
+// isEINVAL reports whether err is the EINVAL of a misaligned O_DIRECT read
+func isEINVAL(err error) bool {
+	pe, ok := err.(*os.PathError)
+	return ok && pe.Err == unix.EINVAL
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// openFile opens the local file called name. --direct-io is only supported
+// on Linux.
+func openFile(name string) (*os.File, io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+// adviseSequential is a no-op without posix_fadvise
+func adviseSequential(f *os.File) {}
+
+// newCacheDropper returns r as is without posix_fadvise
+func newCacheDropper(r io.Reader, f *os.File) io.Reader {
+	return r
+}
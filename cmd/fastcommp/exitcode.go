@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// the exit statuses of fastcommp, which scripts may rely on
+const (
+	// exitOK is every input hashed
+	exitOK = 0
+	// exitFailed is some inputs of a batch, or the single input, failed
+	exitFailed = 1
+	// exitUsage is invalid options or arguments
+	exitUsage = 2
+	// exitIO is the input, or the output, failing to be read or written
+	exitIO = 3
+	// exitTimeout is --timeout or --file-timeout expiring on the input
+	exitTimeout = 4
+	// exitInterrupted is the input interrupted, its progress saved to --state
+	exitInterrupted = 5
+)
+
+// the errorCode of failed records, which scripts may rely on; new codes may
+// be added, but these keep their meaning
+const (
+	codeNotFound    = "notFound"    // the input does not exist, or a 404
+	codePermission  = "permission"  // the input may not be read, or a 401 or 403
+	codeIO          = "io"          // reading the input or writing a result failed
+	codeTimeout     = "timeout"     // --timeout or --file-timeout expired
+	codeInterrupted = "interrupted" // SIGINT or SIGTERM, with --state
+	codeFailed      = "failed"      // anything else, such as an empty payload
+)
+
+// timeoutError is the cause of --timeout and --file-timeout expiring
+type timeoutError struct {
+	flag string
+	d    time.Duration
+}
+
+func (e timeoutError) Error() string {
+	return "timed out after --" + e.flag + " " + e.d.String()
+}
+
+func (e timeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// errorCode returns the errorCode of a record that failed with err
+func errorCode(err error) string {
+	var status interface{ HTTPStatusCode() int }
+	var errno syscall.Errno
+	var nerr net.Error
+	var perr *fs.PathError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codeTimeout
+	case errors.Is(err, errInterrupted):
+		return codeInterrupted
+	case errors.Is(err, fs.ErrNotExist):
+		return codeNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return codePermission
+	case errors.As(err, &status):
+		switch status.HTTPStatusCode() {
+		case http.StatusNotFound, http.StatusGone:
+			return codeNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return codePermission
+		}
+		return codeIO
+	case errors.As(err, &perr), errors.As(err, &errno), errors.As(err, &nerr), errors.Is(err, io.ErrUnexpectedEOF):
+		return codeIO
+	}
+	return codeFailed
+}
+
+// exitStatus returns the exit status for a single input that failed with
+// the errorCode code, or otherwise for a failure that is not about reading,
+// writing or running out of time
+func exitStatus(code string, otherwise int) int {
+	switch code {
+	case codeNotFound, codePermission, codeIO:
+		return exitIO
+	case codeTimeout:
+		return exitTimeout
+	case codeInterrupted:
+		return exitInterrupted
+	}
+	return otherwise
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// httpStatusError is an error carrying an HTTP status, like those of the
+// remote inputs
+type httpStatusError int
+
+func (e httpStatusError) Error() string       { return "HTTP status " + strconv.Itoa(int(e)) }
+func (e httpStatusError) HTTPStatusCode() int { return int(e) }
+
+func TestErrorCode(t *testing.T) {
+	wrap := func(err error) error { return xerrors.Errorf("opening input: %w", err) }
+	for _, tc := range []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{wrap(&fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist}), codeNotFound, exitIO},
+		{wrap(&fs.PathError{Op: "open", Path: "x", Err: fs.ErrPermission}), codePermission, exitIO},
+		{wrap(&fs.PathError{Op: "read", Path: "x", Err: syscall.EIO}), codeIO, exitIO},
+		{wrap(io.ErrUnexpectedEOF), codeIO, exitIO},
+		{wrap(httpStatusError(404)), codeNotFound, exitIO},
+		{wrap(httpStatusError(403)), codePermission, exitIO},
+		{wrap(httpStatusError(500)), codeIO, exitIO},
+		{wrap(timeoutError{"timeout", time.Minute}), codeTimeout, exitTimeout},
+		{wrap(context.DeadlineExceeded), codeTimeout, exitTimeout},
+		{wrap(errInterrupted), codeInterrupted, exitInterrupted},
+		{xerrors.New("commP is not defined for an empty payload"), codeFailed, exitFailed},
+	} {
+		if code := errorCode(tc.err); code != tc.code {
+			t.Errorf("%s: errorCode %q, want %q", tc.err, code, tc.code)
+		} else if status := exitStatus(code, exitFailed); status != tc.status {
+			t.Errorf("%s: exit status %d, want %d", tc.err, status, tc.status)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	dir := t.TempDir()
+	good, empty, missing := filepath.Join(dir, "good.bin"), filepath.Join(dir, "empty.bin"), filepath.Join(dir, "missing.bin")
+	if err := os.WriteFile(good, make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		status int
+	}{
+		{"hashed", []string{good}, exitOK},
+		{"missing input", []string{missing}, exitIO},
+		{"empty input", []string{empty}, exitFailed},
+		{"unknown option", []string{"--no-such-option", good}, exitUsage},
+		{"bad output format", []string{"--output-format", "yaml", good}, exitUsage},
+		{"batch with failures", []string{good, missing}, exitFailed},
+		{"batch", []string{good, good}, exitOK},
+	} {
+		if _, stderr, status := runMain(t, append([]string{"-q"}, tc.args...)...); status != tc.status {
+			t.Errorf("%s: exit status %d, want %d: %s", tc.name, status, tc.status, stderr)
+		}
+	}
+
+	// the records of a batch say why each input failed
+	out, _, status := runMain(t, "-q", "--output-format", "jsonl", good, missing, empty)
+	if status != exitFailed {
+		t.Errorf("exit status %d, want %d", status, exitFailed)
+	}
+	codes := map[string]string{}
+	for lines := bufio.NewScanner(strings.NewReader(out)); lines.Scan(); {
+		var rec flatRecord
+		if err := json.Unmarshal(lines.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		codes[rec.Path] = rec.ErrorCode
+	}
+	if codes[good] != "" || codes[missing] != codeNotFound || codes[empty] != codeFailed || len(codes) != 3 {
+		t.Errorf("error codes %v", codes)
+	}
+}
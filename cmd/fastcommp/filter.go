@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// filter selects the files of a recursive run by glob patterns matched
+// against their slash-separated path relative to the walked directory. A
+// pattern without a slash also matches the base name at any depth.
+type filter struct {
+	include []string
+	exclude []string
+}
+
+// newFilter checks the patterns and returns a filter using them
+func newFilter(include, exclude []string) (filter, error) {
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter{}, xerrors.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return filter{include: include, exclude: exclude}, nil
+}
+
+// excluded reports whether rel matches an exclude pattern
+func (f filter) excluded(rel string) bool {
+	return matchAny(f.exclude, rel)
+}
+
+// selected reports whether the file rel is hashed
+func (f filter) selected(rel string) bool {
+	if len(f.include) != 0 && !matchAny(f.include, rel) {
+		return false
+	}
+	return !f.excluded(rel)
+}
+
+// matchAny reports whether rel matches any of patterns
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = base
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
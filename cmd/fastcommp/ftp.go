@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/jlaffaye/ftp"
+	"golang.org/x/xerrors"
+)
+
+// openFTP streams the file at ftp://[user@]host[:port]/path, logging in
+// anonymously when no user is given
+func openFTP(u *url.URL) (input, error) {
+	user, pass, err := remoteUser(u)
+	if err != nil {
+		return input{}, err
+	}
+	if user == "" {
+		user, pass = "anonymous", "anonymous"
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+	conn, err := ftp.Dial(host)
+	if err != nil {
+		return input{}, xerrors.Errorf("connecting to %s: %w", host, err)
+	}
+	if err := conn.Login(user, pass); err != nil {
+		conn.Quit()
+		return input{}, xerrors.Errorf("logging in to %s: %w", host, err)
+	}
+
+	size, err := conn.FileSize(u.Path)
+	if err != nil {
+		size = -1
+	}
+	resp, err := conn.Retr(u.Path)
+	if err != nil {
+		conn.Quit()
+		return input{}, xerrors.Errorf("retrieving %s: %w", u.Path, err)
+	}
+	return input{ReadCloser: &remoteReader{Reader: resp, closers: []io.Closer{resp, ftpQuit{conn}}}, size: size}, nil
+}
+
+// ftpQuit closes an FTP connection by quitting it
+type ftpQuit struct {
+	conn *ftp.ServerConn
+}
+
+func (q ftpQuit) Close() error {
+	return q.conn.Quit()
+}
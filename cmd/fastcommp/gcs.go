@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/xerrors"
+)
+
+// gcsClient is created once with Application Default Credentials
+var gcsClient = sync.OnceValues(func() (*storage.Client, error) {
+	return storage.NewClient(context.Background())
+})
+
+// openGCS streams the object gs://bucket/key
+func openGCS(u *url.URL) (input, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return input{}, xerrors.Errorf("invalid GCS URL %s, expected gs://bucket/key", u)
+	}
+
+	client, err := gcsClient()
+	if err != nil {
+		return input{}, xerrors.Errorf("creating GCS client: %w", err)
+	}
+	obj := client.Bucket(bucket).Object(key)
+	r, err := obj.NewReader(context.Background())
+	if err != nil {
+		return input{}, xerrors.Errorf("reading %s: %w", u, err)
+	}
+	return input{
+		ReadCloser: r,
+		size:       r.Attrs.Size,
+		resume: func(off int64) (io.ReadCloser, error) {
+			return obj.NewRangeReader(context.Background(), off, -1)
+		},
+	}, nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// result is the outcome of hashing one input
+type result struct {
+	Path string
+	fastcommp.DataCIDSize
+	// PieceCIDv2 is the FIP-0069 piece CID, for --piece-cid-version both
+	PieceCIDv2 *cidLink `json:",omitempty"`
+	// CommitmentHex and MultihashHex are PieceCommitment and Multihash in
+	// hex, for tooling that takes raw bytes rather than CIDs
+	CommitmentHex string `json:",omitempty"`
+	MultihashHex  string `json:",omitempty"`
+	// Stat describes the source file, with --stat
+	Stat *fileStat `json:",omitempty"`
+	// Cached is set when the sum was taken from --xattr or --sidecar
+	// rather than hashed again
+	Cached bool `json:",omitempty"`
+	// PiecePath is where --rename or --link-dir put the file under the name
+	// of its piece CID
+	PiecePath string `json:",omitempty"`
+	// Completed is when the input was done with
+	Completed time.Time
+	stages
+	Error string `json:",omitempty"`
+	// ErrorCode is the kind of Error, one of the stable codes of exitcode.go
+	ErrorCode string `json:",omitempty"`
+
+	// read is the time spent waiting for input and readBytes the number of
+	// bytes read, elapsed the time taken by the whole input
+	read      time.Duration
+	readBytes int64
+	elapsed   time.Duration
+}
+
+// fail records err as the outcome of res
+func (res *result) fail(err error) {
+	res.Error, res.ErrorCode = err.Error(), errorCode(err)
+}
+
+// stages is the time taken by each stage of hashing an input, and the
+// throughput of the payload through it, to tell disk-bound from CPU-bound
+// runs. The hashing time is added up over all hashing threads.
+type stages struct {
+	ReadSeconds float64 `json:",omitempty"`
+	HashSeconds float64 `json:",omitempty"`
+	TreeSeconds float64 `json:",omitempty"`
+	ReadGiBps   float64 `json:",omitempty"`
+	HashGiBps   float64 `json:",omitempty"`
+	TreeGiBps   float64 `json:",omitempty"`
+}
+
+// newStages returns the stages of hashing n bytes in the given times
+func newStages(n int64, read, hash, tree time.Duration) stages {
+	gibps := func(d time.Duration) float64 {
+		if d <= 0 {
+			return 0
+		}
+		return float64(n) / (1 << 30) / d.Seconds()
+	}
+	return stages{
+		ReadSeconds: read.Seconds(),
+		HashSeconds: hash.Seconds(),
+		TreeSeconds: tree.Seconds(),
+		ReadGiBps:   gibps(read),
+		HashGiBps:   gibps(hash),
+		TreeGiBps:   gibps(tree),
+	}
+}
+
+// finishResult fills in the fields of a successful res that derive from its
+// sum
+func finishResult(res *result) error {
+	if err := setPieceCIDVersion(res); err != nil {
+		return err
+	}
+	res.CommitmentHex = hex.EncodeToString(res.PieceCommitment)
+	res.MultihashHex = hex.EncodeToString(res.Multihash)
+	res.stages = newStages(res.PayloadSize, res.read, res.Timings.Hash, res.Timings.Tree)
+	return nil
+}
+
+// hashInput streams the input called name through a new CommpWriter
+func hashInput(ctx context.Context, name string, writerOpts []fastcommp.Option) (result, error) {
+	return withTimeout(ctx, name, func(ctx context.Context) (result, error) {
+		in, err := openPayload(name)
+		if err != nil {
+			return result{Path: name}, xerrors.Errorf("opening input: %w", err)
+		}
+		var res result
+		if sum, ok := cachedSum(name, in.stat, writerOpts); ok {
+			in.Close()
+			res = result{Path: name, DataCIDSize: sum, Cached: true}
+		} else if res, err = hashPayload(ctx, name, in, writerOpts); err != nil {
+			return res, err
+		}
+		if opts.Stat && in.stat != nil {
+			res.Stat = newFileStat(in.stat)
+		}
+		if err := storeSum(name, in.stat, res.DataCIDSize, res.Cached); err != nil {
+			return res, err
+		}
+		res.PiecePath, err = nameFile(name, in.stat, res.DataCIDSize)
+		return res, err
+	})
+}
+
+// withTimeout runs hash under ctx, limited by --file-timeout, and gives up
+// on it once ctx is done. A hash stuck in a call that ignores ctx, such as a
+// read from a stalled NFS mount, is left behind to finish on its own.
+func withTimeout(ctx context.Context, path string, hash func(ctx context.Context) (result, error)) (result, error) {
+	if opts.FileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.FileTimeout, timeoutError{"file-timeout", opts.FileTimeout})
+		defer cancel()
+	}
+
+	type outcome struct {
+		res result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := hash(ctx)
+		done <- outcome{res, err}
+	}()
+	var o outcome
+	select {
+	case o = <-done:
+		if ctx.Err() != nil {
+			o.err = context.Cause(ctx)
+		}
+	case <-ctx.Done():
+		o = outcome{result{Path: path}, context.Cause(ctx)}
+	}
+	o.res.Completed = time.Now()
+	return o.res, o.err
+}
+
+// openPayload opens the input called name, decompressing it if needed
+func openPayload(name string) (input, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return input{}, err
+	}
+	dec, err := decompressInput(name, in)
+	if err != nil {
+		in.Close()
+		return input{}, err
+	}
+	return dec, nil
+}
+
+// hashPayload hashes the opened input in, reported under path, and closes it
+func hashPayload(ctx context.Context, path string, in input, writerOpts []fastcommp.Option) (result, error) {
+	res := result{Path: path}
+	defer in.Close()
+
+	total := in.size
+	if _, n, err := inputRange(in.size); err == nil {
+		total = n
+	}
+	j, progress, stop := startJob(path, total)
+	defer stop()
+	writerOpts = append(slices.Clip(writerOpts), progress)
+
+	// the shortcuts for local files hash without a writer, so they cannot be
+	// checkpointed to --state
+	local := in.file != nil && in.size > 0 && !opts.Tee && opts.State == ""
+	if local && !opts.DirectIO {
+		if res, ok, err := hashSparse(ctx, res, in.file, in.size, writerOpts); ok {
+			return res, err
+		}
+	}
+	if local && opts.Mmap {
+		if res, ok, err := hashMapped(ctx, res, in.file, in.size, writerOpts); ok {
+			return res, err
+		}
+	}
+	// leaf buffers are not aligned for O_DIRECT reads through the ring
+	if local && opts.IOUring && !opts.DirectIO {
+		if res, ok, err := hashURing(ctx, res, in.file, in.size, writerOpts); ok {
+			return res, err
+		}
+	}
+
+	if opts.Offset != 0 || opts.Length >= 0 {
+		sliced, err := sliceInput(in)
+		if err != nil {
+			return res, xerrors.Errorf("opening input: %w", err)
+		}
+		in = sliced
+	}
+
+	// fetch leaf-sized ranges over several connections at once and hash them
+	// as they arrive
+	if opts.Connections > 1 && in.at != nil && !opts.Tee && opts.State == "" {
+		in.Close()
+
+		start := time.Now()
+		sum, err := fastcommp.SumReaderAtContext(ctx, in.at, in.size, append(writerOpts, fastcommp.WithConcurrency(opts.Connections))...)
+		if err != nil {
+			return res, xerrors.Errorf("calculating commP: %w", err)
+		}
+		res.DataCIDSize = sum
+		res.elapsed = time.Since(start)
+		res.read, res.readBytes = res.elapsed, in.size
+		return res, nil
+	}
+
+	w, err := fastcommp.NewCommpWriter(writerOpts...)
+	if err != nil {
+		return res, err
+	}
+	defer w.Close()
+
+	// carry on from the progress saved by an interrupted run
+	var resumed int64
+	if opts.State != "" {
+		if resumed, err = loadState(w, path); err != nil {
+			return res, err
+		}
+		if err := skipTo(in.ReadCloser, resumed); err != nil {
+			return res, xerrors.Errorf("resuming input: %w", err)
+		}
+		j.base.Store(resumed)
+	}
+
+	// the input is read ahead into a ring of buffers while the writer hashes
+	// full leaves in the background
+	start := time.Now()
+	r := &meteredReader{r: in}
+	if in.file != nil {
+		r.r = newCacheDropper(in, in.file)
+	}
+	if opts.Tee {
+		r.r = io.TeeReader(r.r, os.Stdout)
+	}
+	written, err := readAhead(ctx, w, r)
+	if err == errInterrupted {
+		if err := saveState(w, path, resumed+written); err != nil {
+			return res, xerrors.Errorf("saving state: %w", err)
+		}
+		return res, savedError{resumed + written}
+	}
+	if err != nil {
+		return res, xerrors.Errorf("reading input: %w", err)
+	}
+	if in.size >= 0 && resumed+r.n != in.size {
+		return res, xerrors.Errorf("read %d bytes, but the input announced %d", resumed+r.n, in.size)
+	}
+	sum, err := w.SumContext(ctx)
+	if err != nil {
+		return res, xerrors.Errorf("calculating commP: %w", err)
+	}
+	if opts.State != "" {
+		os.Remove(opts.State)
+	}
+
+	res.DataCIDSize = sum
+	res.read = r.elapsed
+	res.readBytes = r.n
+	res.elapsed = time.Since(start)
+	return res, nil
+}
+
+// hashAll hashes inputs with up to jobs of them in flight, sending their
+// results on the returned channel in the order of inputs, whichever finishes
+// first, so that the output of two runs can be diffed. A failed input is
+// reported with its Error set.
+func hashAll(ctx context.Context, inputs []string, jobs int, writerOpts []fastcommp.Option) <-chan result {
+	type indexed struct {
+		i    int
+		name string
+		res  result
+	}
+	names := make(chan indexed)
+	go func() {
+		defer close(names)
+		for i, name := range inputs {
+			names <- indexed{i: i, name: name}
+		}
+	}()
+
+	finished := make(chan indexed)
+	done := make(chan struct{})
+	for i := 0; i < jobs; i++ {
+		go func() {
+			defer func() {
+				done <- struct{}{}
+			}()
+			for in := range names {
+				res, err := hashInput(ctx, in.name, writerOpts)
+				if err != nil {
+					res.fail(err)
+				}
+				in.res = res
+				batchStatus.finishInput(res)
+				finished <- in
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < jobs; i++ {
+			<-done
+		}
+		close(finished)
+	}()
+
+	// hold back the results that overtook an earlier input
+	results := make(chan result)
+	go func() {
+		defer close(results)
+		pending := make(map[int]result)
+		next := 0
+		for f := range finished {
+			pending[f.i] = f.res
+			for res, ok := pending[next]; ok; res, ok = pending[next] {
+				delete(pending, next)
+				results <- res
+				next++
+			}
+		}
+	}()
+	return results
+}
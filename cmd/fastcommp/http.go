@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pborman/getopt/v2"
+	"golang.org/x/xerrors"
+)
+
+// headerList collects repeated --header options without splitting them at
+// commas, which are common in header values
+type headerList []string
+
+// Set adds one "Name: value" header, or clears the list for an empty value
+func (h *headerList) Set(value string, _ getopt.Option) error {
+	if value == "" {
+		*h = nil
+		return nil
+	}
+	if name, _, ok := strings.Cut(value, ":"); !ok || strings.TrimSpace(name) == "" {
+		return xerrors.Errorf("invalid header %q, expected \"Name: value\"", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+func (h *headerList) String() string {
+	return strings.Join(*h, "\n")
+}
+
+// httpClient sends the requests of HTTP-based sources, through --proxy if
+// set or else through the proxy named by HTTPS_PROXY and friends
+var httpClient = sync.OnceValues(func() (*http.Client, error) {
+	if opts.Proxy == "" {
+		return http.DefaultClient, nil
+	}
+	proxy, err := url.Parse(opts.Proxy)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid proxy %q: %w", opts.Proxy, err)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyURL(proxy)
+	return &http.Client{Transport: t}, nil
+})
+
+// newRequest returns a GET request for target carrying the --header headers
+func newRequest(target string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range opts.Headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return req, nil
+}
+
+// doHTTP sends req with httpClient
+func doHTTP(req *http.Request) (*http.Response, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// openHTTP streams the body of a GET request for u. The Content-Length of the
+// response, if any, becomes the size of the input.
+func openHTTP(u *url.URL) (input, error) {
+	req, err := newRequest(u.String())
+	if err != nil {
+		return input{}, err
+	}
+	return fetchHTTP(req)
+}
+
+// fetchHTTP sends req and streams the body of a successful response
+func fetchHTTP(req *http.Request) (input, error) {
+	resp, err := doHTTP(req)
+	if err != nil {
+		return input{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return input{}, &statusError{url: req.URL.Redacted(), status: resp.Status, code: resp.StatusCode}
+	}
+	in := input{ReadCloser: resp.Body, size: resp.ContentLength}
+	if resp.ContentLength > 0 && resp.Header.Get("Accept-Ranges") == "bytes" {
+		in.at = httpReaderAt{req: req}
+		in.resume = func(off int64) (io.ReadCloser, error) {
+			return resumeHTTP(req, off)
+		}
+	}
+	return in, nil
+}
+
+// resumeHTTP fetches the rest of the payload of req from offset off
+func resumeHTTP(req *http.Request, off int64) (io.ReadCloser, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+
+	resp, err := doHTTP(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, &statusError{url: req.URL.Redacted(), status: resp.Status, code: resp.StatusCode}
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// stdinName is the input name that reads the payload from stdin
+const stdinName = "-"
+
+// input is an opened payload
+type input struct {
+	io.ReadCloser
+	// size is the payload size announced by the source, or -1 if unknown
+	size int64
+	// at, if set, reads arbitrary byte ranges of a payload of known size,
+	// for sources that can fetch several ranges at once
+	at io.ReaderAt
+	// resume, if set, reopens the payload at offset off after a transient
+	// failure
+	resume func(off int64) (io.ReadCloser, error)
+	// file, if set, is the local file the payload is read from
+	file *os.File
+	// stat, if set, describes the local file the payload comes from, which
+	// may be compressed
+	stat os.FileInfo
+}
+
+// sourceFunc opens the payload at a URL of the scheme it is registered for
+type sourceFunc func(u *url.URL) (input, error)
+
+// sources are the URL schemes accepted as inputs besides local paths
+var sources = map[string]sourceFunc{
+	"http":  openHTTP,
+	"https": openHTTP,
+	"s3":    openS3,
+	"gs":    openGCS,
+	"az":    openAzure,
+	"sftp":  openSFTP,
+	"ftp":   openFTP,
+	"ipfs":  openIPFS,
+}
+
+// sourceURL returns the parsed URL of name if its scheme is one of sources
+func sourceURL(name string) (*url.URL, bool) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, false
+	}
+	_, ok := sources[strings.ToLower(u.Scheme)]
+	return u, ok
+}
+
+// openInput opens the payload named on the command line: a path, "-" for
+// stdin, or a URL of one of the sources
+func openInput(name string) (input, error) {
+	if name == stdinName {
+		return input{ReadCloser: ioutil.NopCloser(os.Stdin), size: -1}, nil
+	}
+	if u, ok := sourceURL(name); ok {
+		return openRemote(sources[strings.ToLower(u.Scheme)], u)
+	}
+
+	// unix sockets cannot be opened, only connected to; like FIFOs they are
+	// streamed until EOF without a known size
+	if fi, err := os.Stat(name); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", name)
+		if err != nil {
+			return input{}, err
+		}
+		return input{ReadCloser: conn, size: -1}, nil
+	}
+
+	f, rc, err := openFile(name)
+	if err != nil {
+		return input{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return input{}, err
+	}
+	size := int64(-1)
+	switch mode := fi.Mode(); {
+	case mode.IsRegular():
+		size = fi.Size()
+		adviseSequential(f)
+	case mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0:
+		// block devices stat as empty; ask the device for its size
+		if size, err = deviceSize(f); err != nil {
+			f.Close()
+			return input{}, xerrors.Errorf("getting the size of device %s: %w", name, err)
+		}
+	}
+	return input{ReadCloser: rc, size: size, file: f, stat: fi}, nil
+}
+
+// openRemote opens u with open, retrying transient failures. The reads of
+// the opened input are retried as well, resuming at the offset reached when
+// the source supports it.
+func openRemote(open sourceFunc, u *url.URL) (input, error) {
+	var in input
+	err := withRetry(func() error {
+		var err error
+		in, err = open(u)
+		return err
+	})
+	if err != nil {
+		return input{}, err
+	}
+
+	if in.resume != nil {
+		in.ReadCloser = &resumingReader{rc: in.ReadCloser, resume: in.resume}
+	}
+	if in.at != nil {
+		in.at = retryReaderAt{at: in.at}
+	}
+	return in, nil
+}
+
+// stdinPiped reports whether stdin is a pipe or a file rather than a terminal
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice == 0
+}
+
+// walkInputs replaces each directory in args with the regular files found
+// under it that are selected by f, in lexical order. Directories matching an
+// exclude pattern are skipped entirely.
+func walkInputs(args []string, f filter) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if _, ok := sourceURL(arg); ok || arg == stdinName {
+			inputs = append(inputs, arg)
+			continue
+		}
+		root := arg
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if rel != "." && f.excluded(rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && f.selected(rel) {
+				inputs = append(inputs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return inputs, nil
+}
+
+// readFileList reads input names separated by sep from the file called name,
+// or from stdin if it is "-". Empty names are skipped, as is the carriage
+// return ending a line of a newline-separated list.
+func readFileList(name string, sep byte) ([]string, error) {
+	in, err := openInput(name)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, 1<<20)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var names []string
+	for sc.Scan() {
+		name := sc.Text()
+		if sep == '\n' {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, xerrors.Errorf("reading file list %s: %w", name, err)
+	}
+	return names, nil
+}
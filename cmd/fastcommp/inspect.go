@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+)
+
+// codecNames are the names of the codecs inspect knows, from the multicodec
+// table
+var codecNames = map[uint64]string{
+	cid.Raw:                   "raw",
+	cid.DagProtobuf:           "dag-pb",
+	cid.DagCBOR:               "dag-cbor",
+	cid.DagJSON:               "dag-json",
+	cid.Libp2pKey:             "libp2p-key",
+	cid.FilCommitmentUnsealed: "fil-commitment-unsealed",
+	cid.FilCommitmentSealed:   "fil-commitment-sealed",
+}
+
+// cidInfo is what inspect tells of a CID
+type cidInfo struct {
+	CID           string `json:"cid"`
+	Version       uint64 `json:"version"`
+	Multibase     string `json:"multibase"`
+	Codec         string `json:"codec"`
+	CodecCode     uint64 `json:"codecCode"`
+	Multihash     string `json:"multihash"`
+	MultihashCode uint64 `json:"multihashCode"`
+	Digest        string `json:"digest"`
+
+	// for piece CIDs
+	Commitment string `json:"commitment,omitempty"`
+	// for piece CIDs v2, with the v1 CID of the same commitment
+	PieceCID    string `json:"pieceCid,omitempty"`
+	TreeHeight  *int   `json:"treeHeight,omitempty"`
+	PieceSize   uint64 `json:"pieceSize,omitempty"`
+	Padding     uint64 `json:"padding,omitempty"`
+	PayloadSize uint64 `json:"payloadSize,omitempty"`
+
+	// Problems are why the CID is not a valid piece CID, despite its
+	// multihash
+	Problems []string `json:"problems,omitempty"`
+}
+
+// runInspect decodes each CID and prints its parts, and for piece CIDs the
+// commitment and the sizes a v2 one encodes, to debug mismatched commitments
+func runInspect(args []string) int {
+	var iopts struct {
+		Help bool `getopt:"--help -h display this help"`
+		JSON bool `getopt:"--json print each CID as a JSON object per line"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp inspect")
+	set.SetParameters("CID ...")
+	options.RegisterSet("inspect", &iopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if iopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) == 0 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+
+	status := exitOK
+	for i, arg := range args {
+		info, err := inspectCID(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			status = exitFailed
+			continue
+		}
+		if iopts.JSON {
+			line, _ := json.Marshal(info)
+			fmt.Println(string(line))
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		info.print()
+	}
+	return status
+}
+
+// inspectCID decodes the CID s
+func inspectCID(s string) (cidInfo, error) {
+	c, err := cid.Decode(s)
+	if err != nil {
+		return cidInfo{}, xerrors.Errorf("decoding CID %s: %w", s, err)
+	}
+	dm, err := multihash.Decode(c.Hash())
+	if err != nil {
+		return cidInfo{}, xerrors.Errorf("decoding the multihash of %s: %w", s, err)
+	}
+	info := cidInfo{
+		CID:           s,
+		Version:       c.Version(),
+		Multibase:     "base58btc",
+		CodecCode:     c.Type(),
+		Codec:         codecNames[c.Type()],
+		MultihashCode: dm.Code,
+		Multihash:     dm.Name,
+		Digest:        hex.EncodeToString(dm.Digest),
+	}
+	if c.Version() != 0 {
+		enc, _ := cid.ExtractEncoding(s)
+		info.Multibase = multibase.EncodingToStr[enc]
+	}
+
+	var commP []byte
+	switch dm.Code {
+	case multihash.SHA2_256_TRUNC254_PADDED:
+		commP = dm.Digest
+		info.Commitment = info.Digest
+		if c.Type() != cid.FilCommitmentUnsealed {
+			info.problem("a piece CID v1 has the codec fil-commitment-unsealed (0x%x)", cid.FilCommitmentUnsealed)
+		}
+		if dm.Length != 32 {
+			info.problem("the commitment is %d bytes, not 32", dm.Length)
+		}
+	case fr32Sha256Trunc254Padbintree:
+		info.Multihash = "fr32-sha256-trunc254-padbintree"
+		padding, height, digest, err := splitPieceDigest(dm.Digest)
+		if err != nil {
+			info.problem("%s", err)
+			break
+		}
+		commP = digest
+		info.Commitment = hex.EncodeToString(commP)
+		if v1, err := commcid.PieceCommitmentV1ToCID(commP); err == nil {
+			info.PieceCID = v1.String()
+		}
+		info.TreeHeight, info.Padding = &height, padding
+		if c.Type() != cid.Raw {
+			info.problem("a piece CID v2 has the codec raw (0x%x)", cid.Raw)
+		}
+		// the tree height counts the layers above the 32-byte nodes
+		if height < 2 || height > 57 {
+			info.problem("tree height %d is not of a piece of 128 bytes or more", height)
+			break
+		}
+		pieceSize := abi.PaddedPieceSize(32) << height
+		info.PieceSize = uint64(pieceSize)
+		if padding >= uint64(pieceSize.Unpadded()) {
+			info.problem("%d bytes of padding leave no payload in a piece of %d bytes", padding, pieceSize)
+			break
+		}
+		info.PayloadSize = uint64(pieceSize.Unpadded()) - padding
+	}
+	// a commitment is a 254-bit field element, as sha2-256-trunc254 leaves it
+	if len(commP) == 32 && commP[31]&0xc0 != 0 {
+		info.problem("the commitment has its two top bits set, so it is not truncated to 254 bits")
+	}
+	return info, nil
+}
+
+// problem records why the CID is not a valid piece CID
+func (info *cidInfo) problem(format string, args ...interface{}) {
+	info.Problems = append(info.Problems, fmt.Sprintf(format, args...))
+}
+
+// print prints the parts of the CID for people
+func (info cidInfo) print() {
+	name := func(name string, code uint64) string {
+		if name == "" {
+			name = "unknown"
+		}
+		return fmt.Sprintf("%s (0x%x)", name, code)
+	}
+	fmt.Printf("CID:          %s\n", info.CID)
+	fmt.Printf("Version:      %d\n", info.Version)
+	fmt.Printf("Multibase:    %s\n", info.Multibase)
+	fmt.Printf("Codec:        %s\n", name(info.Codec, info.CodecCode))
+	fmt.Printf("Multihash:    %s\n", name(info.Multihash, info.MultihashCode))
+	fmt.Printf("Digest:       %s\n", info.Digest)
+	if info.Commitment != "" {
+		fmt.Printf("Commitment:   %s\n", info.Commitment)
+	}
+	if info.PieceCID != "" {
+		fmt.Printf("Piece CID v1: %s\n", info.PieceCID)
+	}
+	if info.TreeHeight != nil {
+		fmt.Printf("Tree height:  %d\n", *info.TreeHeight)
+		fmt.Printf("Padding:      %d bytes\n", info.Padding)
+	}
+	if info.PieceSize != 0 {
+		fmt.Printf("Piece size:   %d bytes (%s)\n", info.PieceSize, formatSize(int64(info.PieceSize)))
+	}
+	if info.PayloadSize != 0 {
+		fmt.Printf("Payload size: %d bytes (%s)\n", info.PayloadSize, formatSize(int64(info.PayloadSize)))
+	}
+	for _, p := range info.Problems {
+		fmt.Printf("Problem:      %s\n", p)
+	}
+}
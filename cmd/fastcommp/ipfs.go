@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// defaultIPFSGateway is used for ipfs:// inputs unless --ipfs-gateway is set
+const defaultIPFSGateway = "https://ipfs.io"
+
+// openIPFS streams the DAG at ipfs://<cid>[/path] as a CARv1 from a
+// trustless gateway, so the commP is that of the CAR file a deal is made for
+func openIPFS(u *url.URL) (input, error) {
+	c, err := cid.Decode(u.Host)
+	if err != nil {
+		return input{}, xerrors.Errorf("invalid CID in %s: %w", u, err)
+	}
+
+	gateway := opts.IPFSGateway
+	if gateway == "" {
+		gateway = defaultIPFSGateway
+	}
+	target := strings.TrimRight(gateway, "/") + "/ipfs/" + c.String() + u.EscapedPath() + "?format=car"
+	req, err := newRequest(target)
+	if err != nil {
+		return input{}, xerrors.Errorf("invalid IPFS gateway %q: %w", gateway, err)
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.car;version=1;order=dfs;dups=y")
+	return fetchHTTP(req)
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+
+	"github.com/application-research/fastcommp"
+)
+
+// subcommands run instead of hashing when named by the first argument
+var subcommands = map[string]func(args []string) int{
+	"aggregate": runAggregate,
+	"diff":      runDiff,
+	"inspect":   runInspect,
+	"compact":   runCompact,
+	"convert":   runConvert,
+	"size":      runSize,
+	"split":     runSplit,
+	"zero":      runZero,
+
+	"verify-inclusion": runVerifyInclusion,
+}
+
+// opts are the command-line options
+var opts = struct {
+	Help         options.Help  `getopt:"--help -h display this help"`
+	Recursive    bool          `getopt:"--recursive -r hash every regular file under the given directories"`
+	CPUs         int           `getopt:"--cpus=N hash with N CPUs (default: GOMAXPROCS, which follows cgroup CPU quotas)"`
+	NUMANode     string        `getopt:"--numa-node=NODE hash on the CPUs and memory of NUMA node NODE, or auto for the node of the first local input's storage (Linux)"`
+	Jobs         int           `getopt:"--jobs=N hash up to N files at once (default: one per CPU, at most one per file)"`
+	Threads      int           `getopt:"--threads=N hash N leaves of each file at once (default: the CPUs divided by --jobs)"`
+	Cat          bool          `getopt:"--cat hash the inputs back to back as a single payload"`
+	Tee          bool          `getopt:"--tee copy the payload to stdout and print the results on stderr"`
+	Mmap         bool          `getopt:"--mmap memory-map local files and hash them in place, except on network filesystems"`
+	DirectIO     bool          `getopt:"--direct-io read local files with O_DIRECT, bypassing the page cache"`
+	IOUring      bool          `getopt:"--io-uring read local files through io_uring (Linux, built with -tags iouring; not with --direct-io)"`
+	ReadBuffer   byteSize      `getopt:"--read-buffer=SIZE size of each read from an input, such as 64KiB or 16MiB (default 8MiB)"`
+	MaxMemory    byteSize      `getopt:"--max-memory=SIZE keep buffers within SIZE, such as 2GiB, by shrinking reads and parallelism"`
+	Include      []string      `getopt:"--include=GLOB with -r, only hash files matching GLOB (repeatable)"`
+	Exclude      []string      `getopt:"--exclude=GLOB with -r, skip files and directories matching GLOB (repeatable)"`
+	FilesFrom    string        `getopt:"--files-from=FILE read newline-separated input names from FILE, - for stdin"`
+	FilesFrom0   string        `getopt:"--files-from0=FILE read NUL-separated input names from FILE, - for stdin"`
+	SSHKey       string        `getopt:"--ssh-key=FILE private key for sftp:// inputs"`
+	PasswordFile string        `getopt:"--password-file=FILE read the password of sftp:// and ftp:// inputs from FILE"`
+	IPFSGateway  string        `getopt:"--ipfs-gateway=URL trustless gateway for ipfs:// inputs (default https://ipfs.io)"`
+	Connections  int           `getopt:"--connections=N fetch N leaf-aligned ranges of http(s):// and s3:// inputs at once"`
+	Retries      int           `getopt:"--retries=N retry transient failures of remote inputs N times (default 5)"`
+	RetryBackoff time.Duration `getopt:"--retry-backoff=DURATION delay before the first retry, doubled for each further one (default 1s)"`
+	Proxy        string        `getopt:"--proxy=URL proxy for http(s):// and ipfs:// inputs, instead of HTTPS_PROXY"`
+	Headers      headerList    `getopt:"--header=HEADER add a \"Name: value\" header to http(s):// and ipfs:// requests (repeatable)"`
+	Decompress   bool          `getopt:"--decompress decompress gzip and zstd inputs whatever their name; .gz and .zst files always are"`
+	Offset       int64         `getopt:"--offset=BYTES hash the input starting at byte BYTES"`
+	SectorSize   byteSize      `getopt:"--sector-size=SIZE pad each piece to a sector of SIZE, one of 2KiB, 8MiB, 512MiB, 32GiB or 64GiB, failing payloads that do not fit (default: the smallest piece that holds the payload)"`
+	ProofType    string        `getopt:"--proof-type=PROOF pad each piece to a sector of the seal proof PROOF, such as StackedDrg64GiBV1 or StackedDrg32GiBV1_1, like --sector-size"`
+	TargetSize   byteSize      `getopt:"--target-piece-size=SIZE pad each piece with zeros to SIZE, a power of two such as 32GiB, for deals made at a fixed piece size, failing payloads that do not fit"`
+	Length       int64         `getopt:"--length=BYTES hash only BYTES bytes of the input (default: up to the end)"`
+	Timeout      time.Duration `getopt:"--timeout=DURATION give up on the whole run after DURATION, such as 2h"`
+	FileTimeout  time.Duration `getopt:"--file-timeout=DURATION give up on an input that takes longer than DURATION, such as 10m"`
+	Output       string        `getopt:"--output -o=FILE write the results to FILE, replacing it only once they are complete"`
+	Manifest     string        `getopt:"--manifest=FILE with several inputs, also write a JSON manifest of all results and their totals to FILE"`
+	Append       string        `getopt:"--append-manifest=FILE append the record of each input to FILE as a line of JSON, under a lock so that concurrent runs can share it; see fastcommp compact"`
+	SignKey      string        `getopt:"--sign-key=FILE sign the --manifest with the ed25519 private key in FILE (PEM), writing the signature to the manifest's name plus .sig"`
+	CIDVersion   string        `getopt:"--piece-cid-version=VERSION print v1 piece CIDs, v2 (FIP-0069) ones with 2, or both (default 1)"`
+	CIDBase      cidBase       `getopt:"--cid-base=BASE print CIDs in multibase BASE, such as base58btc or base16 (default base32)"`
+	NoColor      bool          `getopt:"--no-color print the human-readable output without colors, as does setting NO_COLOR"`
+	Quiet        bool          `getopt:"--quiet -q print only the results, without the banner, timings and summary"`
+	CIDOnly      bool          `getopt:"--cid-only print only the piece CID of each input"`
+	OutputFormat string        `getopt:"--output-format=FORMAT print a record per input as json, jsonl (JSON Lines), csv, cbor, dag-json or parquet"`
+	Format       string        `getopt:"--format=TEMPLATE print a record per input with a Go template, such as '{{.PieceCID}} {{.PieceSize}}'"`
+	State        string        `getopt:"--state=FILE save progress to FILE on SIGINT or SIGTERM, and resume from it when it exists"`
+	Progress     string        `getopt:"--progress=MODE draw the progress on stderr when it is a terminal (auto, the default), print it as JSON events (json), or not at all (none)"`
+	TUI          bool          `getopt:"--tui show a live dashboard of the files in flight, the totals and the latest failures while hashing"`
+	ProgressTo   string        `getopt:"--progress-to=FILE with --progress json, write the events to FILE, such as a named pipe, instead of stderr"`
+	Stat         bool          `getopt:"--stat record the size, mtime, mode, inode and device of local input files"`
+	Sidecar      bool          `getopt:"--sidecar write the piece of each local input file, and its size and mtime, to <file>.commp.json"`
+	Rename       bool          `getopt:"--rename rename each local input file to <pieceCID>.<ext>, the name piece stores use"`
+	LinkDir      string        `getopt:"--link-dir=DIR hardlink each local input file into DIR as <pieceCID>.<ext>"`
+	Force        bool          `getopt:"--force hash inputs again even when --xattr or --sidecar hold a result for them"`
+	Xattr        bool          `getopt:"--xattr store the piece of each local input file in its user.fastcommp.* extended attributes, and reuse it while the file is unchanged"`
+}{
+	Retries:      5,
+	Length:       -1,
+	RetryBackoff: time.Second,
+}
+
+// stdout receives the results, or stderr when --tee passes the payload
+// through on stdout
+var stdout io.Writer = os.Stdout
+
+// stderr receives the warnings and errors printed while inputs are hashed
+var stderr io.Writer = os.Stderr
+
+// info receives the backend line, the timings and the batch summary, which
+// go to stderr when stdout carries machine-readable records and nowhere with
+// --quiet
+var info io.Writer = os.Stdout
+
+// parseArgs parses the options of set in args, which start with the name of
+// the program, and returns the other arguments. Unlike getopt, which stops at
+// the first of them, options may follow arguments as with GNU tools, and
+// everything after "--" is an argument.
+func parseArgs(set *getopt.Set, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := set.Getopt(args, nil); err != nil {
+			return nil, err
+		}
+		more := set.Args()
+		if len(more) == 0 || set.State() == getopt.DashDash {
+			return append(rest, more...), nil
+		}
+		rest = append(rest, more[0])
+		args = append([]string{args[0]}, more[1:]...)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[1:]))
+		}
+	}
+	options.SetParameters("<filename>|- ...")
+	options.Register(&opts)
+	args, err := parseArgs(getopt.CommandLine, os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		options.PrintUsage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	if opts.Tee {
+		stdout = os.Stderr
+	}
+	info = stdout
+	printer, err := newRecordPrinter()
+	if err != nil {
+		fmt.Fprintln(stdout, "Error:", err)
+		os.Exit(exitUsage)
+	}
+	if machineReadable() {
+		info = os.Stderr
+	}
+	if opts.Quiet || opts.CIDOnly {
+		info = ioutil.Discard
+	}
+	setupColor()
+
+	// add the names listed by --files-from and --files-from0
+	listed := false
+	for _, list := range []struct {
+		name string
+		sep  byte
+	}{{opts.FilesFrom, '\n'}, {opts.FilesFrom0, 0}} {
+		if list.name == "" {
+			continue
+		}
+		names, err := readFileList(list.name, list.sep)
+		if err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitIO)
+		}
+		args = append(args, names...)
+		listed = true
+	}
+
+	// Get the file names from the command-line arguments, reading stdin when
+	// one is "-" or when data is piped in without any
+	if len(args) == 0 && !listed && stdinPiped() {
+		args = []string{stdinName}
+	}
+	if len(args) == 0 && !listed {
+		options.PrintUsage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+	if opts.FilesFrom == stdinName || opts.FilesFrom0 == stdinName {
+		for _, arg := range args {
+			if arg == stdinName {
+				fmt.Fprintln(stdout, "Error: stdin cannot be both a file list and an input")
+				os.Exit(exitUsage)
+			}
+		}
+	}
+	batch := (len(args) > 1 || opts.Recursive || listed) && !opts.Cat
+	if batch && opts.Tee {
+		fmt.Fprintln(stdout, "Error: --tee takes a single input, or --cat")
+		os.Exit(exitUsage)
+	}
+	if !batch && opts.Manifest != "" {
+		fmt.Fprintln(stdout, "Error: --manifest takes several inputs, -r or a file list")
+		os.Exit(exitUsage)
+	}
+	if opts.SignKey != "" && opts.Manifest == "" {
+		fmt.Fprintln(stdout, "Error: --sign-key signs the --manifest")
+		os.Exit(exitUsage)
+	}
+	if err := checkProgress(); err != nil {
+		fmt.Fprintln(stdout, "Error:", err)
+		os.Exit(exitUsage)
+	}
+	if err := checkPieceCIDVersion(); err != nil {
+		fmt.Fprintln(stdout, "Error:", err)
+		os.Exit(exitUsage)
+	}
+	if err := checkTargetSize(); err != nil {
+		fmt.Fprintln(stdout, "Error:", err)
+		os.Exit(exitUsage)
+	}
+	var proof abi.RegisteredSealProof
+	if padToSector() {
+		if proof, err = sealProof(); err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if (opts.Rename || opts.LinkDir != "") && !wholeFile() {
+		fmt.Fprintln(stdout, "Error: --rename and --link-dir name whole files, not with --offset or --length")
+		os.Exit(exitUsage)
+	}
+	if opts.LinkDir != "" {
+		if fi, err := os.Stat(opts.LinkDir); err != nil || !fi.IsDir() {
+			fmt.Fprintf(stdout, "Error: --link-dir %s is not a directory\n", opts.LinkDir)
+			os.Exit(exitUsage)
+		}
+	}
+	if batch && opts.State != "" {
+		fmt.Fprintln(stdout, "Error: --state takes a single input, or --cat")
+		os.Exit(exitUsage)
+	}
+	var signKey ed25519.PrivateKey
+	if opts.SignKey != "" {
+		if signKey, err = loadSigningKey(opts.SignKey); err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitStatus(errorCode(err), exitUsage))
+		}
+	}
+	handleSignals()
+	if opts.Recursive {
+		exclude := opts.Exclude
+		if opts.Sidecar {
+			// the sidecars of a previous run are not inputs
+			exclude = append(slices.Clip(exclude), "*"+sidecarExt)
+		}
+		f, err := newFilter(opts.Include, exclude)
+		if err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitUsage)
+		}
+		if args, err = walkInputs(args, f); err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitIO)
+		}
+	}
+
+	fmt.Fprintf(info, "SHA-256 backend: %s\n", fastcommp.SHA256Backend())
+
+	// split one hashing goroutine per CPU between the files in flight, unless
+	// --jobs or --threads say otherwise. GOMAXPROCS counts the CPUs allowed
+	// by the cgroup quota rather than all of the machine's.
+	budget := runtime.GOMAXPROCS(0)
+	if opts.NUMANode != "" {
+		if cpus, err := pinNUMA(args); err != nil {
+			warnf("%s, not pinning to a NUMA node", err)
+		} else if cpus > 0 {
+			budget = cpus
+			runtime.GOMAXPROCS(cpus)
+		}
+	}
+	if opts.CPUs > 0 {
+		budget = opts.CPUs
+	}
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = len(args)
+		if jobs > budget {
+			jobs = budget
+		}
+	}
+	if jobs < 1 || opts.Cat {
+		jobs = 1
+	}
+	threads := opts.Threads
+	if threads <= 0 {
+		threads = budget / jobs
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	if opts.MaxMemory > 0 {
+		if err := fitMemory(&jobs, &threads); err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitUsage)
+		}
+		debug.SetMemoryLimit(int64(opts.MaxMemory) - memoryOverhead)
+	}
+	writerOpts := []fastcommp.Option{fastcommp.WithConcurrency(threads)}
+	if opts.MaxMemory > 0 {
+		// fold leaves as they are hashed instead of queueing them all
+		writerOpts = append(writerOpts, fastcommp.WithStreaming())
+	}
+	if padToSector() {
+		writerOpts = append(writerOpts, fastcommp.WithSealProof(proof))
+	}
+	if opts.TargetSize > 0 {
+		writerOpts = append(writerOpts, fastcommp.WithTargetPieceSize(abi.PaddedPieceSize(opts.TargetSize)))
+	}
+	if opts.IOUring && !uringBuilt {
+		warnf("built without io_uring support, reading files normally")
+		opts.IOUring = false
+	}
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.Timeout, timeoutError{"timeout", opts.Timeout})
+		defer cancel()
+	}
+
+	// with -o the results go to a temporary file next to it, moved into
+	// place once they are complete
+	terminal := stdout
+	var output *atomicFile
+	if opts.Output != "" {
+		f, err := createAtomic(opts.Output, 0644)
+		if err != nil {
+			fmt.Fprintln(stdout, "Error:", err)
+			os.Exit(exitIO)
+		}
+		output, stdout = f, f
+	}
+
+	if err := startProgress(args, batch); err != nil {
+		abortOutput(output)
+		fmt.Fprintln(terminal, "Error:", err)
+		os.Exit(exitStatus(errorCode(err), exitUsage))
+	}
+	if !batch {
+		var res result
+		var err error
+		if opts.Cat {
+			res, err = hashConcat(ctx, args, writerOpts)
+		} else {
+			res, err = hashInput(ctx, args[0], writerOpts)
+		}
+		stopProgress()
+		if err == nil {
+			err = finishResult(&res)
+		}
+		if err != nil {
+			res.fail(err)
+		}
+		if opts.Append != "" {
+			if err := appendRecord(opts.Append, newFlatRecord(res)); err != nil {
+				abortOutput(output)
+				fmt.Fprintf(os.Stderr, "Error: appending to %s: %s\n", opts.Append, err)
+				os.Exit(exitIO)
+			}
+		}
+		// an explicit --output-format or --format prints the record of a
+		// batch instead
+		if opts.OutputFormat != "" || opts.Format != "" || opts.CIDOnly {
+			if err := printer.print(res); err != nil {
+				abortOutput(output)
+				fmt.Fprintln(os.Stderr, "Error: printing record:", err)
+				os.Exit(exitIO)
+			}
+			if err := printer.flush(); err != nil {
+				abortOutput(output)
+				fmt.Fprintln(os.Stderr, "Error: printing record:", err)
+				os.Exit(exitIO)
+			}
+			commitOutput(output)
+			if res.Error != "" {
+				os.Exit(exitStatus(res.ErrorCode, exitFailed))
+			}
+			return
+		}
+		if err != nil {
+			abortOutput(output)
+			fmt.Fprintln(terminal, "Error:", err)
+			os.Exit(exitStatus(errorCode(err), exitFailed))
+		}
+		printResult(res)
+		commitOutput(output)
+		return
+	}
+
+	var sum summary
+	var records []flatRecord
+	start := time.Now()
+	for res := range hashAll(ctx, args, jobs, writerOpts) {
+		if res.Error == "" {
+			if err := finishResult(&res); err != nil {
+				res.fail(err)
+			}
+		}
+		sum.add(res)
+		if opts.Manifest != "" {
+			records = append(records, newFlatRecord(res))
+		}
+		if opts.Append != "" {
+			if err := appendRecord(opts.Append, newFlatRecord(res)); err != nil {
+				abortOutput(output)
+				fmt.Fprintf(stderr, "Error: appending to %s: %s\n", opts.Append, err)
+				os.Exit(exitIO)
+			}
+		}
+		if err := printer.print(res); err != nil {
+			abortOutput(output)
+			fmt.Fprintln(stderr, "Error: printing record:", err)
+			os.Exit(exitIO)
+		}
+	}
+	stopProgress()
+	if err := printer.flush(); err != nil {
+		abortOutput(output)
+		fmt.Fprintln(os.Stderr, "Error: printing records:", err)
+		os.Exit(exitIO)
+	}
+	commitOutput(output)
+	sum.elapsed = time.Since(start)
+	if opts.Manifest != "" {
+		if err := writeManifest(opts.Manifest, records, sum, signKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: writing manifest %s: %s\n", opts.Manifest, err)
+			os.Exit(exitIO)
+		}
+	}
+	sum.print()
+	if sum.failed > 0 {
+		os.Exit(exitFailed)
+	}
+}
+
+// commitOutput moves the complete -o file, if any, into place
+func commitOutput(output *atomicFile) {
+	if output == nil {
+		return
+	}
+	if err := output.commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing %s: %s\n", opts.Output, err)
+		os.Exit(exitIO)
+	}
+}
+
+// abortOutput discards the -o file, if any, after a fatal error
+func abortOutput(output *atomicFile) {
+	if output != nil {
+		output.abort()
+	}
+}
+
+// pinNUMA pins the process to the NUMA node chosen by --numa-node and
+// returns its number of CPUs, or 0 if the node of the storage is unknown
+func pinNUMA(inputs []string) (int, error) {
+	node, err := numaNode(opts.NUMANode, inputs)
+	if err != nil {
+		return 0, err
+	}
+	if node < 0 {
+		warnf("NUMA node of the storage is unknown, not pinning")
+		return 0, nil
+	}
+	return pinToNode(node)
+}
+
+// printResult prints the timings and result of a single input
+func printResult(res result) {
+	if res.Cached {
+		fmt.Fprintln(info, paint(colorInfo, "Cached result of the unchanged file, not hashed again", colorCyan))
+	} else {
+		fmt.Fprintf(info, "Elapsed file read time: %s (%s)\n", res.read, throughput(res.readBytes, res.read))
+		fmt.Fprintf(info, "Elapsed hashing time: %s over all threads (%s)\n", res.Timings.Hash, throughput(res.PayloadSize, res.Timings.Hash))
+		fmt.Fprintf(info, "Elapsed tree time: %s\n", res.Timings.Tree)
+		fmt.Fprintf(info, "Elapsed commP time: %s (%s)\n", res.elapsed, throughput(res.PayloadSize, res.elapsed))
+	}
+	fmt.Fprintf(info, "commP: %s\n", paint(colorInfo, opts.CIDBase.format(res.PieceCID), colorBold, colorGreen))
+	if res.PieceCIDv2 != nil {
+		fmt.Fprintf(info, "commPv2: %s\n", paint(colorInfo, res.PieceCIDv2.String(), colorBold, colorGreen))
+	}
+	switch {
+	case padToSector():
+		fmt.Fprintf(info, "Piece size: %s, padded to a whole sector\n", formatSize(int64(res.PieceSize)))
+	case opts.TargetSize > 0:
+		fmt.Fprintf(info, "Piece size: %s, padded to the --target-piece-size\n", formatSize(int64(res.PieceSize)))
+	case res.SectorSize > 0:
+		fmt.Fprintf(info, "Piece size: %s, the smallest that holds the payload, for sectors of %s and up\n", formatSize(int64(res.PieceSize)), formatSize(int64(res.SectorSize)))
+	default:
+		fmt.Fprintf(info, "Piece size: %s, the smallest that holds the payload, larger than any sector\n", formatSize(int64(res.PieceSize)))
+	}
+
+	// Convert the sum results to a JSON string
+	results, err := json.MarshalIndent(sumJSON(res), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(stdout, string(results))
+}
+
+// printRecord prints the result record of one input of a batch, keyed by its
+// path
+func printRecord(res result) {
+	record, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintln(stdout, string(record))
+}
+
+// summary totals the results of a batch
+type summary struct {
+	files   int
+	failed  int
+	bytes   int64
+	elapsed time.Duration
+
+	// pieces groups the paths of the inputs by piece CID, in the order the
+	// CIDs were first seen, to find the inputs that are the same piece
+	pieces map[cid.Cid]*pieceGroup
+	order  []cid.Cid
+}
+
+// pieceGroup is the inputs of a batch that produced the same piece
+type pieceGroup struct {
+	cid   cid.Cid
+	size  abi.PaddedPieceSize
+	paths []string
+}
+
+// add counts res in the summary
+func (s *summary) add(res result) {
+	s.files++
+	if res.Error != "" {
+		s.failed++
+		return
+	}
+	s.bytes += res.PayloadSize
+
+	if s.pieces == nil {
+		s.pieces = make(map[cid.Cid]*pieceGroup)
+	}
+	g, ok := s.pieces[res.PieceCID]
+	if !ok {
+		g = &pieceGroup{cid: res.PieceCID, size: res.PieceSize}
+		s.pieces[res.PieceCID] = g
+		s.order = append(s.order, res.PieceCID)
+	}
+	g.paths = append(g.paths, res.Path)
+}
+
+// duplicates returns the pieces produced by more than one input
+func (s *summary) duplicates() []*pieceGroup {
+	var dups []*pieceGroup
+	for _, c := range s.order {
+		if g := s.pieces[c]; len(g.paths) > 1 {
+			dups = append(dups, g)
+		}
+	}
+	return dups
+}
+
+// print prints the summary line of a batch
+func (s *summary) print() {
+	failed := fmt.Sprintf("%d failed", s.failed)
+	if s.failed > 0 {
+		failed = paint(colorInfo, failed, colorBold, colorRed)
+	}
+	fmt.Fprintf(info, "Hashed %d files (%s), %s bytes in %s (%s)\n", s.files, failed, paint(colorInfo, strconv.FormatInt(s.bytes, 10), colorCyan), s.elapsed, throughput(s.bytes, s.elapsed))
+
+	// storing the same piece twice is paying for it twice
+	dups := s.duplicates()
+	if len(dups) == 0 {
+		return
+	}
+	var wasted uint64
+	for _, g := range dups {
+		wasted += uint64(len(g.paths)-1) * uint64(g.size)
+	}
+	fmt.Fprintf(info, "%s %d (%s stored more than once):\n",
+		paint(colorInfo, "Duplicate pieces:", colorBold, colorYellow), len(dups), formatSize(int64(wasted)))
+	for _, g := range dups {
+		fmt.Fprintf(info, "  %s (%d inputs)\n", paint(colorInfo, opts.CIDBase.format(g.cid), colorYellow), len(g.paths))
+		for _, path := range g.paths {
+			fmt.Fprintf(info, "    %s\n", path)
+		}
+	}
+}
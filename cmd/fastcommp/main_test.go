@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+)
+
+// mainEnv makes the test binary run main instead of the tests, for runMain
+const mainEnv = "FASTCOMMP_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mainEnv) != "" {
+		main()
+		os.Exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs fastcommp with args in a process of its own, so that it may
+// exit, and returns what it printed and its exit status
+func runMain(t *testing.T, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), mainEnv+"=1", "NO_COLOR=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		rest   []string
+		jsonl  bool
+		output string
+	}{
+		{[]string{"a", "b"}, []string{"a", "b"}, false, ""},
+		{[]string{"--jsonl", "a"}, []string{"a"}, true, ""},
+		{[]string{"a", "--jsonl", "b"}, []string{"a", "b"}, true, ""},
+		{[]string{"a", "b", "-jo", "out"}, []string{"a", "b"}, true, "out"},
+		{[]string{"a", "--output", "-b", "c"}, []string{"a", "c"}, false, "-b"},
+		{[]string{"-", "--output=out"}, []string{"-"}, false, "out"},
+		{[]string{"a", "--", "--jsonl", "-b"}, []string{"a", "--jsonl", "-b"}, false, ""},
+		{nil, nil, false, ""},
+	} {
+		var popts struct {
+			JSONL  bool   `getopt:"--jsonl -j"`
+			Output string `getopt:"--output -o=FILE"`
+		}
+		set := getopt.New()
+		options.RegisterSet("test", &popts, set)
+		rest, err := parseArgs(set, append([]string{"test"}, tc.args...))
+		if err != nil {
+			t.Errorf("%q: %s", tc.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, tc.rest) || popts.JSONL != tc.jsonl || popts.Output != tc.output {
+			t.Errorf("%q: got %q, --jsonl %t, --output %q, want %q, %t, %q", tc.args, rest, popts.JSONL, popts.Output, tc.rest, tc.jsonl, tc.output)
+		}
+	}
+
+	set := getopt.New()
+	if _, err := parseArgs(set, []string{"test", "a", "--no-such-option"}); err == nil {
+		t.Error("an unknown option after an argument was accepted")
+	}
+}
+
+func TestOptionsAfterInputs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.bin"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, stderr, status := runMain(t, "-r", dir, "--output-format", "jsonl", "-q")
+	if status != exitOK {
+		t.Fatalf("exit status %d: %s", status, stderr)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], `{"schemaVersion":1,`) {
+		t.Errorf("got %q, want a jsonl record", out)
+	}
+}
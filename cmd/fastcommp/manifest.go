@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+)
+
+// manifest is the --manifest of a batch: the record of every input followed
+// by the totals, for deal-making tools
+type manifest struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Files         []flatRecord   `json:"files"`
+	Totals        manifestTotals `json:"totals"`
+}
+
+// manifestTotals sums up the inputs of a manifest. Failed inputs count
+// towards Files and Failed only.
+type manifestTotals struct {
+	Files       int     `json:"files"`
+	Failed      int     `json:"failed"`
+	PayloadSize int64   `json:"payloadSize"`
+	PieceSize   uint64  `json:"pieceSize"`
+	Duration    float64 `json:"duration"` // seconds, wall clock
+}
+
+// writeManifest writes the manifest of the batch described by records and
+// sum to path, signed by key if any
+func writeManifest(path string, records []flatRecord, sum summary, key ed25519.PrivateKey) error {
+	m := manifest{
+		SchemaVersion: schemaVersion,
+		Files:         records,
+		Totals: manifestTotals{
+			Files:       sum.files,
+			Failed:      sum.failed,
+			PayloadSize: sum.bytes,
+			Duration:    sum.elapsed.Seconds(),
+		},
+	}
+	for _, rec := range records {
+		if rec.Error == "" {
+			m.Totals.PieceSize += rec.PieceSize
+		}
+	}
+	return m.write(path, key)
+}
+
+// write writes the manifest to path, replacing it atomically, and with a key
+// its detached signature of the file to path.sig
+func (m manifest) write(path string, key ed25519.PrivateKey) error {
+	if m.Files == nil {
+		m.Files = []flatRecord{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := createAtomic(path, 0644)
+	if err != nil {
+		return err
+	}
+	// .json.gz and .json.zst manifests are compressed
+	if data, err = compressBytes(compressionOf(path), append(data, '\n')); err != nil {
+		f.abort()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	if err := f.commit(); err != nil {
+		return err
+	}
+	if key == nil {
+		return nil
+	}
+	return writeSignature(path+sigExt, data, key)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/application-research/fastcommp"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// memoryOverhead is set aside from --max-memory for the code and data of
+	// the program itself, outside of the Go heap
+	memoryOverhead = 32 << 20
+	// minReadBuffer is the smallest read buffer --max-memory shrinks to
+	minReadBuffer = 64 << 10
+)
+
+// jobMemory is the most memory one file in flight takes with threads hashing
+// workers and reads of readBuf bytes: the leaf buffers of the workers, the
+// one being filled and the one returned to the pool by the last worker, and
+// the read-ahead ring. A writer in streaming mode keeps no more pending
+// leaves than it has workers.
+func jobMemory(threads int, readBuf int64) int64 {
+	leaves := threads + 2
+	if opts.Connections > leaves {
+		leaves = opts.Connections
+	}
+	return int64(leaves)*int64(fastcommp.CommPBuf) + readAheadChunks*readBuf
+}
+
+// fitMemory shrinks the read buffer, the threads per file and the files in
+// flight, those not set explicitly and in that order, until they fit in the
+// --max-memory budget. It fails if they cannot.
+func fitMemory(jobs, threads *int) error {
+	budget := int64(opts.MaxMemory) - memoryOverhead
+	readBuf := int64(readBuffer())
+	for int64(*jobs)*jobMemory(*threads, readBuf) > budget {
+		switch {
+		case opts.ReadBuffer == 0 && readBuf > minReadBuffer:
+			readBuf /= 2
+		case opts.Threads <= 0 && *threads > 1:
+			*threads--
+		case opts.Jobs <= 0 && *jobs > 1:
+			*jobs--
+		default:
+			return xerrors.Errorf("--max-memory %s is too small: %d files of %d threads need at least %s",
+				formatSize(int64(opts.MaxMemory)), *jobs, *threads, formatSize(int64(*jobs)*jobMemory(*threads, readBuf)+memoryOverhead))
+		}
+	}
+	if opts.ReadBuffer == 0 {
+		opts.ReadBuffer = byteSize(readBuf)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// meteredReader counts the bytes read from r and the time spent waiting for
+// them
+type meteredReader struct {
+	r       io.Reader
+	n       int64
+	elapsed time.Duration
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := m.r.Read(p)
+	m.elapsed += time.Since(start)
+	m.n += int64(n)
+	return n, err
+}
+
+// throughput formats n bytes over d as MiB/s
+func throughput(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f MiB/s", float64(n)/(1<<20)/d.Seconds())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// errNoMmap is returned by mapFile when a file is better read than mapped
+var errNoMmap = xerrors.New("mmap not used for this file")
+
+// hashMapped hashes the local file f of size bytes by mapping it into memory
+// and handing its leaves to the hashing workers in place. ok is false, and
+// the file is to be read instead, if it cannot or should not be mapped.
+func hashMapped(ctx context.Context, res result, f *os.File, size int64, writerOpts []fastcommp.Option) (result, bool, error) {
+	off, n, err := inputRange(size)
+	if err != nil {
+		return res, true, xerrors.Errorf("opening input: %w", err)
+	}
+	if n == 0 {
+		return res, false, nil
+	}
+	data, unmap, err := mapFile(f, size)
+	if err != nil {
+		return res, false, nil
+	}
+	defer unmap()
+
+	start := time.Now()
+	sum, err := fastcommp.SumBytesContext(ctx, data[off:off+n], writerOpts...)
+	if err != nil {
+		return res, true, xerrors.Errorf("calculating commP: %w", err)
+	}
+	res.DataCIDSize = sum
+	res.elapsed = time.Since(start)
+	res.read, res.readBytes = res.elapsed, n
+	return res, true, nil
+}
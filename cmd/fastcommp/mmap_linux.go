@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// networkFS are the statfs magic numbers of filesystems where page faults on
+// a mapping turn into small synchronous network round trips, and read calls
+// with large buffers are faster
+var networkFS = map[int64]bool{
+	unix.NFS_SUPER_MAGIC:  true,
+	unix.SMB_SUPER_MAGIC:  true,
+	unix.SMB2_SUPER_MAGIC: true,
+	unix.CIFS_SUPER_MAGIC: true,
+	unix.FUSE_SUPER_MAGIC: true,
+	0x00c36400:            true, // ceph
+}
+
+// mapFile maps the size bytes of f read-only into memory. It fails with
+// errNoMmap on filesystems where reading performs better.
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(int(f.Fd()), &st); err == nil && networkFS[int64(st.Type)] {
+		return nil, nil, errNoMmap
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("mapping %s: %w", f.Name(), err)
+	}
+	// leaves are hashed in increasing order by the workers
+	_ = unix.Madvise(data, unix.MADV_SEQUENTIAL)
+	return data, func() error { return unix.Munmap(data) }, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// mapFile is only supported on Linux; elsewhere files are read
+func mapFile(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errNoMmap
+}
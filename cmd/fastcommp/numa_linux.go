@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// numaNode resolves --numa-node: a node number, or "auto" for the node of the
+// storage controller holding the first local input. It returns -1 if the node
+// cannot be told.
+func numaNode(spec string, inputs []string) (int, error) {
+	if spec != "auto" {
+		node, err := strconv.Atoi(spec)
+		if err != nil || node < 0 {
+			return -1, xerrors.Errorf("invalid NUMA node %q", spec)
+		}
+		return node, nil
+	}
+	for _, name := range inputs {
+		if _, ok := sourceURL(name); ok || name == stdinName {
+			continue
+		}
+		return deviceNUMANode(name)
+	}
+	return -1, nil
+}
+
+// deviceNUMANode returns the NUMA node of the controller of the block device
+// holding the file called name, or that is the file, found by walking up its
+// sysfs device path
+func deviceNUMANode(name string) (int, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return -1, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, nil
+	}
+	dev := st.Dev
+	if fi.Mode()&os.ModeDevice != 0 {
+		dev = st.Rdev
+	}
+
+	dir, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(dev), unix.Minor(dev)))
+	if err != nil {
+		return -1, nil
+	}
+	for ; strings.HasPrefix(dir, "/sys/devices/"); dir = filepath.Dir(dir) {
+		data, err := os.ReadFile(filepath.Join(dir, "numa_node"))
+		if err != nil {
+			continue
+		}
+		return strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	return -1, nil
+}
+
+// pinToNode restricts every thread of the process, and with them the threads
+// started later, to the CPUs of NUMA node node. Leaf buffers are then first
+// touched, and so allocated, in the memory of that node. It returns the
+// number of CPUs of the node.
+func pinToNode(node int) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", node))
+	if err != nil {
+		return 0, xerrors.Errorf("reading the CPUs of NUMA node %d: %w", node, err)
+	}
+	var set unix.CPUSet
+	for _, r := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		lo, hi, _ := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return 0, xerrors.Errorf("parsing the CPUs of NUMA node %d: %w", node, err)
+		}
+		last := first
+		if hi != "" {
+			if last, err = strconv.Atoi(hi); err != nil {
+				return 0, xerrors.Errorf("parsing the CPUs of NUMA node %d: %w", node, err)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			set.Set(cpu)
+		}
+	}
+	if set.Count() == 0 {
+		return 0, xerrors.Errorf("NUMA node %d has no CPUs", node)
+	}
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.SchedSetaffinity(tid, &set); err != nil {
+			return 0, xerrors.Errorf("pinning thread %d to NUMA node %d: %w", tid, node, err)
+		}
+	}
+	return set.Count(), nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"golang.org/x/xerrors"
+)
+
+var errNoNUMA = xerrors.New("NUMA placement is only supported on Linux")
+
+func numaNode(spec string, inputs []string) (int, error) {
+	return -1, errNoNUMA
+}
+
+func pinToNode(node int) (int, error) {
+	return 0, errNoNUMA
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+)
+
+// recordPrinter prints the result record of each input in an
+// --output-format
+type recordPrinter interface {
+	print(res result) error
+	// flush is called after the last record
+	flush() error
+}
+
+// newRecordPrinter returns the printer for --cid-only, the --format template
+// or the --output-format, one of json, jsonl, csv, cbor, dag-json and parquet
+func newRecordPrinter() (recordPrinter, error) {
+	if opts.CIDOnly {
+		if opts.Format != "" || opts.OutputFormat != "" {
+			return nil, xerrors.New("--cid-only cannot be combined with --format or --output-format")
+		}
+		return cidPrinter{}, nil
+	}
+	if opts.Format != "" {
+		if opts.OutputFormat != "" {
+			return nil, xerrors.New("--format and --output-format cannot be combined")
+		}
+		tmpl, err := template.New("format").Parse(opts.Format)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing --format: %w", err)
+		}
+		return templatePrinter{tmpl}, nil
+	}
+
+	format := opts.OutputFormat
+	switch format {
+	case "", "json":
+		return jsonPrinter{}, nil
+	case "jsonl":
+		return jsonlPrinter{}, nil
+	case "csv":
+		return &csvPrinter{}, nil
+	case "cbor":
+		return ipldPrinter{cbor: true}, nil
+	case "dag-json":
+		return ipldPrinter{}, nil
+	case "parquet":
+		return &parquetPrinter{}, nil
+	}
+	return nil, xerrors.Errorf("unknown output format %q, expected json, jsonl, csv, cbor, dag-json or parquet", format)
+}
+
+// machineReadable reports whether the records are parsed by other tools, so
+// that the backend line and batch summary go to stderr instead of mixing in
+func machineReadable() bool {
+	return opts.CIDOnly || opts.Format != "" || opts.OutputFormat != "" && opts.OutputFormat != "json"
+}
+
+// jsonPrinter prints records as indented JSON documents
+type jsonPrinter struct{}
+
+func (jsonPrinter) print(res result) error {
+	printRecord(res)
+	return nil
+}
+
+func (jsonPrinter) flush() error { return nil }
+
+// schemaVersion is the version of the record layout, carried by every
+// record. Within a version fields are only ever added, and consumers should
+// ignore fields they do not know; removing, renaming or changing the meaning
+// of one bumps it.
+const schemaVersion = 1
+
+// flatRecord is the record of one input in the line-oriented formats
+type flatRecord struct {
+	Version     int     `json:"schemaVersion"`
+	Path        string  `json:"path"`
+	PayloadSize int64   `json:"payloadSize"`
+	PieceSize   uint64  `json:"pieceSize"`
+	PieceCID    string  `json:"pieceCid,omitempty"`
+	PieceCIDv2  string  `json:"pieceCidV2,omitempty"`
+	Commitment  string  `json:"commitmentHex,omitempty"`
+	Multihash   string  `json:"multihashHex,omitempty"`
+	Duration    float64 `json:"duration"` // seconds
+	ReadSeconds float64 `json:"readSeconds"`
+	HashSeconds float64 `json:"hashSeconds"`
+	TreeSeconds float64 `json:"treeSeconds"`
+	ReadGiBps   float64 `json:"readGiBps"`
+	HashGiBps   float64 `json:"hashGiBps"`
+	TreeGiBps   float64 `json:"treeGiBps"`
+	*FlatStat
+	Cached    bool      `json:"cached,omitempty"`
+	PiecePath string    `json:"piecePath,omitempty"`
+	Completed time.Time `json:"completed"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode string    `json:"errorCode,omitempty"`
+	// SectorSize is the smallest sector the piece fits in
+	SectorSize uint64 `json:"sectorSize,omitempty"`
+}
+
+// FlatStat is the --stat metadata of a flatRecord, exported so that
+// encoding/json can allocate the embedded pointer when records are read back
+type FlatStat struct {
+	FileSize int64     `json:"fileSize"`
+	Mtime    time.Time `json:"mtime"`
+	Mode     string    `json:"mode"`
+	Inode    uint64    `json:"inode,omitempty"`
+	Device   uint64    `json:"device,omitempty"`
+}
+
+func newFlatRecord(res result) flatRecord {
+	rec := flatRecord{
+		Version:     schemaVersion,
+		Path:        res.Path,
+		PayloadSize: res.PayloadSize,
+		PieceSize:   uint64(res.PieceSize),
+		Commitment:  res.CommitmentHex,
+		Multihash:   res.MultihashHex,
+		Duration:    res.elapsed.Seconds(),
+		ReadSeconds: res.ReadSeconds,
+		HashSeconds: res.HashSeconds,
+		TreeSeconds: res.TreeSeconds,
+		ReadGiBps:   res.ReadGiBps,
+		HashGiBps:   res.HashGiBps,
+		TreeGiBps:   res.TreeGiBps,
+		Cached:      res.Cached,
+		PiecePath:   res.PiecePath,
+		Completed:   res.Completed,
+		Error:       res.Error,
+		ErrorCode:   res.ErrorCode,
+		SectorSize:  uint64(res.SectorSize),
+	}
+	if res.PieceCID.Defined() {
+		rec.PieceCID = opts.CIDBase.format(res.PieceCID)
+	}
+	if res.PieceCIDv2 != nil {
+		rec.PieceCIDv2 = res.PieceCIDv2.String()
+	}
+	if st := res.Stat; st != nil {
+		rec.FlatStat = &FlatStat{st.Size, st.Mtime, st.Mode, st.Inode, st.Device}
+	}
+	return rec
+}
+
+// jsonlPrinter prints one compact JSON object per line
+type jsonlPrinter struct{}
+
+func (jsonlPrinter) print(res result) error {
+	line, err := json.Marshal(newFlatRecord(res))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(line))
+	return err
+}
+
+func (jsonlPrinter) flush() error { return nil }
+
+// csvPrinter prints a header row followed by one row per input
+type csvPrinter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// writeHeader writes the header row unless it has been written already
+func (p *csvPrinter) writeHeader() {
+	if p.w == nil {
+		p.w = csv.NewWriter(stdout)
+	}
+	if !p.header {
+		p.w.Write([]string{"schemaVersion", "path", "payloadSize", "pieceSize", "pieceCid", "pieceCidV2", "commitmentHex", "multihashHex", "duration",
+			"readSeconds", "hashSeconds", "treeSeconds", "readGiBps", "hashGiBps", "treeGiBps",
+			"fileSize", "mtime", "mode", "inode", "device", "cached", "piecePath", "completed", "error", "errorCode", "sectorSize"})
+		p.header = true
+	}
+}
+
+func (p *csvPrinter) print(res result) error {
+	p.writeHeader()
+	rec := newFlatRecord(res)
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	var st [5]string
+	if rec.FlatStat != nil {
+		st = [...]string{
+			strconv.FormatInt(rec.FileSize, 10),
+			rec.Mtime.Format(time.RFC3339Nano),
+			rec.Mode,
+			strconv.FormatUint(rec.Inode, 10),
+			strconv.FormatUint(rec.Device, 10),
+		}
+	}
+	var sectorSize string
+	if rec.SectorSize != 0 {
+		sectorSize = strconv.FormatUint(rec.SectorSize, 10)
+	}
+	p.w.Write([]string{
+		strconv.Itoa(rec.Version),
+		rec.Path,
+		strconv.FormatInt(rec.PayloadSize, 10),
+		strconv.FormatUint(rec.PieceSize, 10),
+		rec.PieceCID,
+		rec.PieceCIDv2,
+		rec.Commitment,
+		rec.Multihash,
+		float(rec.Duration),
+		float(rec.ReadSeconds),
+		float(rec.HashSeconds),
+		float(rec.TreeSeconds),
+		float(rec.ReadGiBps),
+		float(rec.HashGiBps),
+		float(rec.TreeGiBps),
+		st[0], st[1], st[2], st[3], st[4],
+		strconv.FormatBool(rec.Cached),
+		rec.PiecePath,
+		rec.Completed.Format(time.RFC3339Nano),
+		rec.Error,
+		rec.ErrorCode,
+		sectorSize,
+	})
+	// flush every row, so a long batch can be followed as it goes
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func (p *csvPrinter) flush() error {
+	p.writeHeader()
+	p.w.Flush()
+	return p.w.Error()
+}
+
+// ipldPrinter prints records as IPLD data, with pieceCid as a link rather
+// than a string: a sequence of DAG-CBOR objects, or DAG-JSON objects one per
+// line
+type ipldPrinter struct {
+	cbor bool
+}
+
+func (p ipldPrinter) print(res result) error {
+	rec := map[string]interface{}{
+		"path":        res.Path,
+		"payloadSize": res.PayloadSize,
+		"pieceSize":   uint64(res.PieceSize),
+		"duration":    res.elapsed.Seconds(),
+	}
+	rec["schemaVersion"] = schemaVersion
+	rec["completed"] = res.Completed.Format(time.RFC3339Nano)
+	if res.Cached {
+		rec["cached"] = true
+	}
+	if res.PiecePath != "" {
+		rec["piecePath"] = res.PiecePath
+	}
+	if res.PieceCID.Defined() {
+		rec["pieceCid"] = res.PieceCID
+	}
+	if res.PieceCIDv2 != nil {
+		rec["pieceCidV2"] = cid.Cid(*res.PieceCIDv2)
+	}
+	if st := res.Stat; st != nil {
+		rec["fileSize"] = st.Size
+		rec["mtime"] = st.Mtime.Format(time.RFC3339Nano)
+		rec["mode"] = st.Mode
+		rec["inode"] = st.Inode
+		rec["device"] = st.Device
+	}
+	if res.Error == "" {
+		rec["commitmentHex"] = res.CommitmentHex
+		rec["multihashHex"] = res.MultihashHex
+		rec["readSeconds"] = res.ReadSeconds
+		rec["hashSeconds"] = res.HashSeconds
+		rec["treeSeconds"] = res.TreeSeconds
+		rec["readGiBps"] = res.ReadGiBps
+		rec["hashGiBps"] = res.HashGiBps
+		rec["treeGiBps"] = res.TreeGiBps
+	} else {
+		rec["error"] = res.Error
+		rec["errorCode"] = res.ErrorCode
+	}
+	if res.SectorSize != 0 {
+		rec["sectorSize"] = uint64(res.SectorSize)
+	}
+	nd, err := cbornode.WrapObject(rec, multihash.SHA2_256, -1)
+	if err != nil {
+		return err
+	}
+
+	if p.cbor {
+		_, err = stdout.Write(nd.RawData())
+		return err
+	}
+	line, err := nd.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(line))
+	return err
+}
+
+func (ipldPrinter) flush() error { return nil }
+
+// templatePrinter prints each record with a --format template, followed by
+// a newline
+type templatePrinter struct {
+	tmpl *template.Template
+}
+
+func (p templatePrinter) print(res result) error {
+	var data interface{} = res
+	if opts.CIDBase.set() {
+		data = struct {
+			result
+			PieceCID string
+		}{res, opts.CIDBase.format(res.PieceCID)}
+	}
+	if err := p.tmpl.Execute(stdout, data); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(stdout)
+	return err
+}
+
+func (templatePrinter) flush() error { return nil }
+
+// Duration is the time it took to hash the input, for --format templates
+func (res result) Duration() time.Duration {
+	return res.elapsed
+}
+
+// cidPrinter prints just the piece CID of each input, one per line. Failed
+// inputs are reported on stderr.
+type cidPrinter struct{}
+
+func (cidPrinter) print(res result) error {
+	if res.Error != "" {
+		fmt.Fprintf(stderr, "%s %s: %s\n", paint(colorErr, "Error:", colorRed), res.Path, res.Error)
+		return nil
+	}
+	_, err := fmt.Fprintln(stdout, opts.CIDBase.format(res.PieceCID))
+	return err
+}
+
+func (cidPrinter) flush() error { return nil }
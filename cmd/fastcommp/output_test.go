@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// captureStdout sends the records printed until t ends to the returned
+// buffer
+func captureStdout(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	saved := stdout
+	stdout = &buf
+	t.Cleanup(func() { stdout = saved })
+	return &buf
+}
+
+// testResults returns the records of a batch to print: two hashed inputs,
+// one of them with --stat metadata, and a failed one
+func testResults(t *testing.T) []result {
+	t.Helper()
+	completed := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	var results []result
+	for i, payload := range [][]byte{bytes.Repeat([]byte{1}, 1000), bytes.Repeat([]byte{2}, 300000)} {
+		sum, err := fastcommp.SumBytes(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := result{
+			Path:        []string{"a.bin", "dir/b, \"c\".bin"}[i],
+			DataCIDSize: sum,
+			Completed:   completed.Add(time.Duration(i) * time.Second),
+			read:        time.Millisecond,
+			elapsed:     3 * time.Millisecond,
+		}
+		if err := finishResult(&res); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+	results[1].Stat = &fileStat{Size: 300000, Mtime: completed.Add(-time.Hour), Mode: "-rw-r--r--", Inode: 42, Device: 7}
+	failed := result{Path: "missing.bin", Completed: completed.Add(2 * time.Second)}
+	failed.fail(xerrors.Errorf("opening input: %w", &fs.PathError{Op: "open", Path: "missing.bin", Err: fs.ErrNotExist}))
+	return append(results, failed)
+}
+
+// printRecords prints results in the --output-format format and returns the
+// output
+func printRecords(t *testing.T, format string, results []result) []byte {
+	t.Helper()
+	opts.OutputFormat = format
+	out := captureStdout(t)
+	p, err := newRecordPrinter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if err := p.print(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestJSONLOutput(t *testing.T) {
+	saveOpts(t)
+	opts.CIDVersion = "both"
+	results := testResults(t)
+	out := printRecords(t, "jsonl", results)
+
+	lines := bufio.NewScanner(bytes.NewReader(out))
+	var got []flatRecord
+	for lines.Scan() {
+		var rec flatRecord
+		if err := json.Unmarshal(lines.Bytes(), &rec); err != nil {
+			t.Fatalf("line %d: %s: %s", len(got)+1, err, lines.Bytes())
+		}
+		got = append(got, rec)
+	}
+	if len(got) != len(results) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(got), len(results), out)
+	}
+	for i, res := range results {
+		if want := newFlatRecord(res); !reflect.DeepEqual(got[i], want) {
+			t.Errorf("record %d:\ngot  %+v\nwant %+v", i, got[i], want)
+		}
+	}
+	if got[0].PieceCID != results[0].PieceCID.String() || got[0].PieceCIDv2 == "" {
+		t.Errorf("piece CIDs %q, %q, want %s and a v2 CID", got[0].PieceCID, got[0].PieceCIDv2, results[0].PieceCID)
+	}
+	if got[2].ErrorCode != codeNotFound || got[2].PieceCID != "" {
+		t.Errorf("failed record has errorCode %q, pieceCid %q", got[2].ErrorCode, got[2].PieceCID)
+	}
+
+	// the records are newline-delimited for tools reading them as a stream
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for n := 0; ; n++ {
+		var m map[string]interface{}
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if m["schemaVersion"] != float64(schemaVersion) {
+			t.Errorf("record %d has schemaVersion %v", n, m["schemaVersion"])
+		}
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	saveOpts(t)
+	results := testResults(t)
+	rows, err := csv.NewReader(bytes.NewReader(printRecords(t, "csv", results))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(results)+1 {
+		t.Fatalf("got %d rows, want a header and %d records", len(rows), len(results))
+	}
+	header := rows[0]
+	if header[0] != "schemaVersion" || header[1] != "path" || len(header) != 26 {
+		t.Fatalf("header %q", header)
+	}
+	for i, row := range rows[1:] {
+		if len(row) != len(header) {
+			t.Fatalf("record %d has %d columns, want %d", i, len(row), len(header))
+		}
+		field := make(map[string]string, len(row))
+		for j, name := range header {
+			field[name] = row[j]
+		}
+		rec := newFlatRecord(results[i])
+		for name, want := range map[string]string{
+			"schemaVersion": strconv.Itoa(schemaVersion),
+			"path":          rec.Path,
+			"payloadSize":   strconv.FormatInt(rec.PayloadSize, 10),
+			"pieceSize":     strconv.FormatUint(rec.PieceSize, 10),
+			"pieceCid":      rec.PieceCID,
+			"commitmentHex": rec.Commitment,
+			"completed":     rec.Completed.Format(time.RFC3339Nano),
+			"errorCode":     rec.ErrorCode,
+		} {
+			if field[name] != want {
+				t.Errorf("record %d: %s is %q, want %q", i, name, field[name], want)
+			}
+		}
+		if d, err := strconv.ParseFloat(field["duration"], 64); err != nil || d != rec.Duration {
+			t.Errorf("record %d: duration %q, want %v", i, field["duration"], rec.Duration)
+		}
+	}
+	// the --stat columns are empty without it, the sector size for failures
+	if rows[1][15] != "" || rows[2][16] != "2024-05-01T11:30:00.123456789Z" || rows[2][18] != "42" {
+		t.Errorf("stat columns %q and %q", rows[1][15:20], rows[2][15:20])
+	}
+	if sectorSize := rows[3][25]; sectorSize != "" || rows[1][25] == "" {
+		t.Errorf("sector sizes %q and %q", rows[1][25], sectorSize)
+	}
+
+	// an empty batch is just the header
+	rows, err = csv.NewReader(bytes.NewReader(printRecords(t, "csv", nil))).ReadAll()
+	if err != nil || len(rows) != 1 || !reflect.DeepEqual(rows[0], header) {
+		t.Errorf("empty batch: %q, %v", rows, err)
+	}
+}
+
+func TestIPLDOutput(t *testing.T) {
+	saveOpts(t)
+	opts.CIDVersion = "both"
+	results := testResults(t)
+
+	for _, format := range []string{"cbor", "dag-json"} {
+		// decode the records one at a time, then check that a batch is them
+		// back to back
+		var batch []byte
+		for i, res := range results {
+			out := printRecords(t, format, []result{res})
+			batch = append(batch, out...)
+			data := out
+			if format == "dag-json" {
+				if !bytes.HasSuffix(out, []byte("\n")) || bytes.Count(out, []byte("\n")) != 1 {
+					t.Fatalf("%s record %d is not one line: %q", format, i, out)
+				}
+				nd, err := cbornode.FromJSON(bytes.NewReader(out), multihash.SHA2_256, -1)
+				if err != nil {
+					t.Fatalf("%s record %d: %s", format, i, err)
+				}
+				data = nd.RawData()
+			}
+			var rec map[string]interface{}
+			if err := cbornode.DecodeInto(data, &rec); err != nil {
+				t.Fatalf("%s record %d: %s", format, i, err)
+			}
+
+			if rec["path"] != res.Path || fmt.Sprint(rec["payloadSize"]) != fmt.Sprint(res.PayloadSize) ||
+				fmt.Sprint(rec["pieceSize"]) != fmt.Sprint(uint64(res.PieceSize)) || fmt.Sprint(rec["schemaVersion"]) != fmt.Sprint(schemaVersion) {
+				t.Errorf("%s record %d: %v", format, i, rec)
+			}
+			if res.Error != "" {
+				if _, ok := rec["pieceCid"]; ok || rec["errorCode"] != res.ErrorCode {
+					t.Errorf("%s record %d: failed record %v", format, i, rec)
+				}
+				continue
+			}
+			// the piece CIDs are links, not strings
+			if c, ok := rec["pieceCid"].(cid.Cid); !ok || !c.Equals(res.PieceCID) {
+				t.Errorf("%s record %d: pieceCid %#v, want a link to %s", format, i, rec["pieceCid"], res.PieceCID)
+			}
+			if c, ok := rec["pieceCidV2"].(cid.Cid); !ok || !c.Equals(cid.Cid(*res.PieceCIDv2)) {
+				t.Errorf("%s record %d: pieceCidV2 %#v, want a link", format, i, rec["pieceCidV2"])
+			}
+			if rec["commitmentHex"] != res.CommitmentHex {
+				t.Errorf("%s record %d: commitmentHex %v", format, i, rec["commitmentHex"])
+			}
+		}
+		if out := printRecords(t, format, results); !bytes.Equal(out, batch) {
+			t.Errorf("%s batch is not its records back to back", format)
+		}
+	}
+}
+
+func TestTemplateOutput(t *testing.T) {
+	saveOpts(t)
+	results := testResults(t)[:2]
+	opts.Format = "{{.Path}} {{.PieceCID}} {{.PayloadSize}} {{.Duration}}"
+	out := printRecords(t, "", results)
+	want := fmt.Sprintf("a.bin %s 1000 3ms\ndir/b, \"c\".bin %s 300000 3ms\n", results[0].PieceCID, results[1].PieceCID)
+	if string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	// the piece CID is printed in the --cid-base
+	if err := opts.CIDBase.Set("base16", nil); err != nil {
+		t.Fatal(err)
+	}
+	opts.Format = "{{.PieceCID}}"
+	out = printRecords(t, "", results[:1])
+	if c, err := cid.Decode(string(bytes.TrimSpace(out))); err != nil || out[0] != 'f' || !c.Equals(results[0].PieceCID) {
+		t.Errorf("got %q, want %s in base16", out, results[0].PieceCID)
+	}
+
+	opts.Format = "{{.Path"
+	if _, err := newRecordPrinter(); err == nil {
+		t.Error("an unterminated template was accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// parquetRowGroup is the number of records buffered into each row group
+const parquetRowGroup = 64 << 10
+
+// parquetSchema holds the columns of a flatRecord; pieceCid and the hex
+// columns are null for failed inputs, pieceCidV2 without --piece-cid-version
+// both, the file columns without --stat, piecePath without --rename or
+// --link-dir, error and errorCode for successful inputs and sectorSize for
+// failed ones and pieces larger than any sector
+var parquetSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "schemaVersion", Type: arrow.PrimitiveTypes.Int32},
+	{Name: "path", Type: arrow.BinaryTypes.String},
+	{Name: "payloadSize", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "pieceSize", Type: arrow.PrimitiveTypes.Uint64},
+	{Name: "pieceCid", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "pieceCidV2", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "commitmentHex", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "multihashHex", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "duration", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "readSeconds", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "hashSeconds", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "treeSeconds", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "readGiBps", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "hashGiBps", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "treeGiBps", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "fileSize", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	{Name: "mtime", Type: arrow.FixedWidthTypes.Timestamp_ns, Nullable: true},
+	{Name: "mode", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "inode", Type: arrow.PrimitiveTypes.Uint64, Nullable: true},
+	{Name: "device", Type: arrow.PrimitiveTypes.Uint64, Nullable: true},
+	{Name: "cached", Type: arrow.FixedWidthTypes.Boolean},
+	{Name: "piecePath", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "completed", Type: arrow.FixedWidthTypes.Timestamp_ns},
+	{Name: "error", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "errorCode", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "sectorSize", Type: arrow.PrimitiveTypes.Uint64, Nullable: true},
+}, nil)
+
+// parquetPrinter writes the records as a Snappy-compressed Parquet file,
+// for loading into DuckDB, Athena and the like
+type parquetPrinter struct {
+	w    *pqarrow.FileWriter
+	b    *array.RecordBuilder
+	rows int
+}
+
+func (p *parquetPrinter) print(res result) error {
+	if p.w == nil {
+		props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+		w, err := pqarrow.NewFileWriter(parquetSchema, unclosable{stdout}, props, pqarrow.DefaultWriterProps())
+		if err != nil {
+			return err
+		}
+		p.w = w
+		p.b = array.NewRecordBuilder(memory.DefaultAllocator, parquetSchema)
+	}
+
+	rec := newFlatRecord(res)
+	p.b.Field(0).(*array.Int32Builder).Append(int32(rec.Version))
+	p.b.Field(1).(*array.StringBuilder).Append(rec.Path)
+	p.b.Field(2).(*array.Int64Builder).Append(rec.PayloadSize)
+	p.b.Field(3).(*array.Uint64Builder).Append(rec.PieceSize)
+	appendNullable(p.b.Field(4).(*array.StringBuilder), rec.PieceCID)
+	appendNullable(p.b.Field(5).(*array.StringBuilder), rec.PieceCIDv2)
+	appendNullable(p.b.Field(6).(*array.StringBuilder), rec.Commitment)
+	appendNullable(p.b.Field(7).(*array.StringBuilder), rec.Multihash)
+	for i, f := range []float64{rec.Duration, rec.ReadSeconds, rec.HashSeconds, rec.TreeSeconds, rec.ReadGiBps, rec.HashGiBps, rec.TreeGiBps} {
+		p.b.Field(8 + i).(*array.Float64Builder).Append(f)
+	}
+	if st := rec.FlatStat; st != nil {
+		p.b.Field(15).(*array.Int64Builder).Append(st.FileSize)
+		p.b.Field(16).(*array.TimestampBuilder).Append(arrow.Timestamp(st.Mtime.UnixNano()))
+		p.b.Field(17).(*array.StringBuilder).Append(st.Mode)
+		p.b.Field(18).(*array.Uint64Builder).Append(st.Inode)
+		p.b.Field(19).(*array.Uint64Builder).Append(st.Device)
+	} else {
+		for i := 15; i <= 19; i++ {
+			p.b.Field(i).AppendNull()
+		}
+	}
+	p.b.Field(20).(*array.BooleanBuilder).Append(rec.Cached)
+	appendNullable(p.b.Field(21).(*array.StringBuilder), rec.PiecePath)
+	p.b.Field(22).(*array.TimestampBuilder).Append(arrow.Timestamp(rec.Completed.UnixNano()))
+	appendNullable(p.b.Field(23).(*array.StringBuilder), rec.Error)
+	appendNullable(p.b.Field(24).(*array.StringBuilder), rec.ErrorCode)
+	if rec.SectorSize != 0 {
+		p.b.Field(25).(*array.Uint64Builder).Append(rec.SectorSize)
+	} else {
+		p.b.Field(25).AppendNull()
+	}
+
+	p.rows++
+	if p.rows == parquetRowGroup {
+		return p.writeRowGroup()
+	}
+	return nil
+}
+
+// writeRowGroup writes the buffered records as a row group
+func (p *parquetPrinter) writeRowGroup() error {
+	batch := p.b.NewRecordBatch()
+	defer batch.Release()
+	p.rows = 0
+	return p.w.Write(batch)
+}
+
+func (p *parquetPrinter) flush() error {
+	// a batch without inputs still gets a valid, empty file
+	if p.w == nil {
+		w, err := pqarrow.NewFileWriter(parquetSchema, unclosable{stdout}, parquet.NewWriterProperties(), pqarrow.DefaultWriterProps())
+		if err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	defer p.b.Release()
+	if p.rows > 0 {
+		if err := p.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+	return p.w.Close()
+}
+
+// unclosable hides the Close method of stdout or the -o file from the
+// Parquet writer, which closes its sink when done
+type unclosable struct {
+	io.Writer
+}
+
+// appendNullable appends s, or null if it is empty
+func appendNullable(b *array.StringBuilder, s string) {
+	if s == "" {
+		b.AppendNull()
+		return
+	}
+	b.Append(s)
+}
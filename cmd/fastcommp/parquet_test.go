@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// readParquet reads back the table of a Parquet file
+func readParquet(t *testing.T, data []byte) arrow.Table {
+	t.Helper()
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(data), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(table.Release)
+	return table
+}
+
+func TestParquetOutput(t *testing.T) {
+	saveOpts(t)
+	results := testResults(t)
+	table := readParquet(t, printRecords(t, "parquet", results))
+	if int(table.NumRows()) != len(results) {
+		t.Fatalf("got %d rows, want %d", table.NumRows(), len(results))
+	}
+	schema := table.Schema()
+	for i, f := range parquetSchema.Fields() {
+		if got := schema.Field(i); got.Name != f.Name || !arrow.TypeEqual(got.Type, f.Type) {
+			t.Errorf("column %d is %s %s, want %s %s", i, got.Name, got.Type, f.Name, f.Type)
+		}
+	}
+
+	tr := array.NewTableReader(table, -1)
+	defer tr.Release()
+	var row int
+	for tr.Next() {
+		rec := tr.RecordBatch()
+		paths := rec.Column(1).(*array.String)
+		pieceSizes := rec.Column(3).(*array.Uint64)
+		pieceCIDs := rec.Column(4).(*array.String)
+		inodes := rec.Column(18).(*array.Uint64)
+		completed := rec.Column(22).(*array.Timestamp)
+		errorCodes := rec.Column(24).(*array.String)
+		for i := 0; i < int(rec.NumRows()); i, row = i+1, row+1 {
+			want := newFlatRecord(results[row])
+			if paths.Value(i) != want.Path || pieceSizes.Value(i) != want.PieceSize ||
+				completed.Value(i) != arrow.Timestamp(want.Completed.UnixNano()) {
+				t.Errorf("row %d: path %q, pieceSize %d, completed %d", row, paths.Value(i), pieceSizes.Value(i), completed.Value(i))
+			}
+			// empty strings and missing --stat metadata are nulls
+			if want.PieceCID == "" {
+				if !pieceCIDs.IsNull(i) || errorCodes.Value(i) != want.ErrorCode {
+					t.Errorf("row %d: failed record has pieceCid %q, errorCode %q", row, pieceCIDs.Value(i), errorCodes.Value(i))
+				}
+			} else if pieceCIDs.Value(i) != want.PieceCID || !errorCodes.IsNull(i) {
+				t.Errorf("row %d: pieceCid %q, want %s", row, pieceCIDs.Value(i), want.PieceCID)
+			}
+			if want.FlatStat == nil && !inodes.IsNull(i) || want.FlatStat != nil && inodes.Value(i) != want.Inode {
+				t.Errorf("row %d: inode %v", row, inodes.GetOneForMarshal(i))
+			}
+		}
+	}
+	if err := tr.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a batch without inputs is a valid file without rows
+	if table := readParquet(t, printRecords(t, "parquet", nil)); table.NumRows() != 0 || table.Schema().NumFields() != len(parquetSchema.Fields()) {
+		t.Errorf("empty batch has %d rows and %d columns", table.NumRows(), table.Schema().NumFields())
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// checkPieceCIDVersion validates --piece-cid-version
+func checkPieceCIDVersion() error {
+	switch opts.CIDVersion {
+	case "", "1", "2", "both":
+		return nil
+	}
+	return xerrors.Errorf("invalid --piece-cid-version %q, expected 1, 2 or both", opts.CIDVersion)
+}
+
+// setPieceCIDVersion switches the piece CID of res to the FIP-0069 CIDv2 with
+// --piece-cid-version 2, or adds it alongside with both
+func setPieceCIDVersion(res *result) error {
+	if opts.CIDVersion != "2" && opts.CIDVersion != "both" {
+		return nil
+	}
+	v2, err := res.DataCIDSize.PieceCIDv2()
+	if err != nil {
+		return xerrors.Errorf("calculating piece CIDv2: %w", err)
+	}
+	if opts.CIDVersion == "both" {
+		link := cidLink(v2)
+		res.PieceCIDv2 = &link
+		return nil
+	}
+	res.PieceCID, res.Multihash = v2, v2.Hash()
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+)
+
+// sectorSizes are the sector sizes of the current seal proofs
+var sectorSizes = []abi.SectorSize{2 << 10, 8 << 20, 512 << 20, 32 << 30, 64 << 30}
+
+// pieceSizes is the piece of a payload, as printed by size
+type pieceSizes struct {
+	PayloadSize int64    `json:"payloadSize"`
+	Fr32Size    int64    `json:"fr32Size"`
+	Unpadded    uint64   `json:"unpaddedPieceSize"`
+	PieceSize   uint64   `json:"pieceSize"`
+	ZeroPadding int64    `json:"zeroPadding"`
+	Overhead    float64  `json:"overhead"`
+	NextPiece   uint64   `json:"nextPieceSize"`
+	SectorSizes []uint64 `json:"sectorSizes"`
+}
+
+// newPieceSizes returns the piece of a payload of n bytes: the smallest
+// power of two of at least 128 bytes whose 127/128 hold the payload once
+// expanded by Fr32
+func newPieceSizes(n int64) pieceSizes {
+	piece := minPiece
+	for int64(piece.Unpadded()) < n {
+		piece *= 2
+	}
+	s := pieceSizes{
+		PayloadSize: n,
+		Fr32Size:    (n*128 + 126) / 127,
+		Unpadded:    uint64(piece.Unpadded()),
+		PieceSize:   uint64(piece),
+		ZeroPadding: int64(piece.Unpadded()) - n,
+		Overhead:    float64(int64(piece)-n) / float64(n),
+		NextPiece:   uint64(2 * piece),
+		SectorSizes: []uint64{},
+	}
+	for _, ss := range sectorSizes {
+		if abi.PaddedPieceSize(ss) >= piece {
+			s.SectorSizes = append(s.SectorSizes, uint64(ss))
+		}
+	}
+	return s
+}
+
+// minPiece is the smallest piece, of 127 bytes of payload
+const minPiece = abi.PaddedPieceSize(128)
+
+// runSize prints the piece sizes of payloads of the given sizes, the Fr32
+// arithmetic that is otherwise done by hand
+func runSize(args []string) int {
+	var sopts struct {
+		Help bool `getopt:"--help -h display this help"`
+		JSON bool `getopt:"--json print the sizes of each payload as a JSON object per line"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp size")
+	set.SetParameters("SIZE ...")
+	options.RegisterSet("size", &sopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if sopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) == 0 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+
+	for i, arg := range args {
+		var n byteSize
+		// past an exbibyte the next piece would overflow
+		if err := n.Set(arg, nil); err != nil || n == 0 || n > 1<<60 {
+			fmt.Fprintf(os.Stderr, "Error: invalid payload size %q, such as 1000000 or 30GiB\n", arg)
+			return exitUsage
+		}
+		s := newPieceSizes(int64(n))
+		if sopts.JSON {
+			line, _ := json.Marshal(s)
+			fmt.Println(string(line))
+			continue
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		sectors := make([]string, len(s.SectorSizes))
+		for j, ss := range s.SectorSizes {
+			sectors[j] = strings.Replace(formatSize(int64(ss)), ".0", "", 1)
+		}
+		if len(sectors) == 0 {
+			sectors = []string{"none, the piece is larger than any sector"}
+		}
+		fmt.Printf("Payload:         %d bytes (%s)\n", s.PayloadSize, formatSize(s.PayloadSize))
+		fmt.Printf("Fr32 padded:     %d bytes\n", s.Fr32Size)
+		fmt.Printf("Unpadded piece:  %d bytes (%s), with %d bytes of zero padding\n", s.Unpadded, formatSize(int64(s.Unpadded)), s.ZeroPadding)
+		fmt.Printf("Piece:           %d bytes (%s), %.1f%% over the payload\n", s.PieceSize, formatSize(int64(s.PieceSize)), s.Overhead*100)
+		fmt.Printf("Next piece:      %d bytes (%s), for payloads over %d bytes\n", s.NextPiece, formatSize(int64(s.NextPiece)), s.Unpadded)
+		fmt.Printf("Sectors:         %s\n", strings.Join(sectors, ", "))
+		if s.PayloadSize < 65 {
+			fmt.Println("Payloads under 65 bytes have no commP of their own, unless padded with --sector-size")
+		}
+	}
+	return exitOK
+}
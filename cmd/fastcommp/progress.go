@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// eventInterval is how often --progress json reports the inputs in flight
+const eventInterval = time.Second
+
+// batchProgress counts the inputs of a batch done with, for the progress
+// bar and --tui
+type batchProgress struct {
+	mu    sync.Mutex
+	start time.Time
+	files int
+	// total is the size of the batch, or negative if one of the inputs has
+	// no size up front; sizes holds the size of each input
+	total int64
+	sizes map[string]int64
+	// finished counts the inputs done with, failed those that failed, and
+	// done their bytes
+	finished int
+	failed   int
+	done     int64
+	// errors holds the latest failures, up to maxErrors
+	errors []string
+}
+
+// maxErrors is the number of failures a batchProgress keeps
+const maxErrors = 10
+
+// batchStatus is the progress of the batch, nil when it is not reported
+var batchStatus *batchProgress
+
+// newBatchProgress returns the progress of a batch of inputs, sizing the
+// local ones
+func newBatchProgress(inputs []string) *batchProgress {
+	p := &batchProgress{
+		start: time.Now(),
+		files: len(inputs),
+		sizes: make(map[string]int64, len(inputs)),
+	}
+	for _, name := range inputs {
+		if _, ok := sourceURL(name); ok || name == stdinName {
+			p.total = -1
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			// the input fails without adding to the batch
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			p.total = -1
+			continue
+		}
+		p.sizes[name] = fi.Size()
+		if p.total >= 0 {
+			p.total += fi.Size()
+		}
+	}
+	return p
+}
+
+// finishInput counts the input of res as done with
+func (p *batchProgress) finishInput(res result) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished++
+	p.done += p.sizes[res.Path]
+	if res.Error != "" {
+		p.failed++
+		p.errors = append(p.errors, res.Path+": "+res.Error)
+		if len(p.errors) > maxErrors {
+			p.errors = p.errors[1:]
+		}
+	}
+}
+
+// snapshot returns a copy of p to read without the lock
+func (p *batchProgress) snapshot() batchProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return batchProgress{
+		start:    p.start,
+		files:    p.files,
+		total:    p.total,
+		finished: p.finished,
+		failed:   p.failed,
+		done:     p.done,
+		errors:   slices.Clone(p.errors),
+	}
+}
+
+// checkProgress checks the --progress mode and --progress-to
+func checkProgress() error {
+	switch opts.Progress {
+	case "", "auto", "json", "none":
+	default:
+		return xerrors.Errorf("unknown --progress %q, expected auto, json or none", opts.Progress)
+	}
+	if opts.TUI && opts.Progress == "json" {
+		return xerrors.New("--tui and --progress json cannot be combined")
+	}
+	if opts.ProgressTo != "" && opts.Progress != "json" {
+		return xerrors.New("--progress-to takes --progress json")
+	}
+	return nil
+}
+
+// startProgress starts reporting the progress of hashing inputs in the
+// --progress mode, or on the --tui dashboard
+func startProgress(inputs []string, batch bool) error {
+	if opts.TUI {
+		return startDashboard(inputs)
+	}
+	switch opts.Progress {
+	case "none":
+		return nil
+	case "json":
+		return startProgressEvents()
+	}
+	startProgressBar(inputs, batch)
+	return nil
+}
+
+// stopProgress stops reporting progress, once the inputs are hashed
+func stopProgress() {
+	stopProgressBar()
+	stopProgressEvents()
+	stopDashboard()
+}
+
+// progressEvent is the --progress json report of an input in flight
+type progressEvent struct {
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+	// Total is the size of the input, if known up front
+	Total int64 `json:"total,omitempty"`
+	// Rate is the throughput since the input started, in bytes per second
+	Rate float64 `json:"rate"`
+	// ETA is the estimated number of seconds left, if Total is known
+	ETA float64 `json:"eta,omitempty"`
+}
+
+// startProgressEvents starts printing a progressEvent for each input in
+// flight every eventInterval, one JSON object per line, on stderr or to
+// --progress-to. Opening a named pipe waits for its reader.
+func startProgressEvents() error {
+	var w io.Writer = stderr
+	var f *os.File
+	if opts.ProgressTo != "" {
+		var err error
+		if f, err = os.OpenFile(opts.ProgressTo, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+			return xerrors.Errorf("opening --progress-to: %w", err)
+		}
+		w = f
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if f != nil {
+			defer f.Close()
+		}
+		enc := json.NewEncoder(w)
+		t := time.NewTicker(eventInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-stop:
+				return
+			}
+			running.Lock()
+			for _, j := range running.jobs {
+				// a reader that went away only loses the events
+				enc.Encode(j.event())
+			}
+			running.Unlock()
+		}
+	}()
+	stopProgressEvents = func() {
+		close(stop)
+		<-stopped
+	}
+	return nil
+}
+
+// stopProgressEvents stops the --progress json reports
+var stopProgressEvents = func() {}
+
+// event reports how far j has got
+func (j *job) event() progressEvent {
+	hashed, base := j.progress(), j.base.Load()
+	ev := progressEvent{File: j.path, Bytes: hashed}
+	if elapsed := time.Since(j.start).Seconds(); elapsed > 0 {
+		ev.Rate = float64(hashed-base) / elapsed
+	}
+	if j.size > 0 {
+		ev.Total = j.size
+		if ev.Rate > 0 {
+			ev.ETA = float64(j.size-hashed) / ev.Rate
+		}
+	}
+	return ev
+}
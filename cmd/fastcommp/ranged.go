@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// httpReaderAt reads byte ranges of a remote file with Range requests cloned
+// from req
+type httpReaderAt struct {
+	req *http.Request
+}
+
+// ReadAt fetches len(p) bytes at off with a single Range request
+func (h httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req := h.req.Clone(h.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+
+	resp, err := doHTTP(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, &statusError{url: req.URL.Redacted(), status: resp.Status, code: resp.StatusCode}
+	}
+	return io.ReadFull(resp.Body, p)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/application-research/fastcommp"
+)
+
+// readAheadChunks is the number of buffers in the read-ahead ring
+const readAheadChunks = 4
+
+// defaultReadBuffer is the size of each read without --read-buffer, about a
+// leaf at the default leaf size
+const defaultReadBuffer = 8 << 20
+
+// readBuffer returns the size of the reads from an input
+func readBuffer() int {
+	if opts.ReadBuffer > 0 {
+		return int(opts.ReadBuffer)
+	}
+	return defaultReadBuffer
+}
+
+// readAhead copies r to w. A producer goroutine reads up to readAheadChunks
+// chunks of readBuffer bytes ahead into a ring of buffers while w hashes, so
+// the source is never idle waiting for a free hashing slot. It returns early
+// when ctx is done, leaving a producer blocked in a read behind, and with
+// errInterrupted between two writes once interrupted is closed.
+func readAhead(ctx context.Context, w *fastcommp.CommpWriter, r io.Reader) (int64, error) {
+	free := make(chan []byte, readAheadChunks)
+	for i := 0; i < readAheadChunks; i++ {
+		free <- make([]byte, readBuffer())
+	}
+	full := make(chan []byte, readAheadChunks)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var rerr error
+	go func() {
+		defer close(full)
+		for {
+			var buf []byte
+			select {
+			case buf = <-free:
+			case <-stop:
+				return
+			}
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				full <- buf[:n]
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				rerr = err
+				return
+			}
+		}
+	}()
+
+	var total int64
+	for {
+		var buf []byte
+		select {
+		case b, ok := <-full:
+			if !ok {
+				return total, rerr
+			}
+			buf = b
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-interrupted:
+			return total, errInterrupted
+		}
+		n, err := w.WriteContext(ctx, buf)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		free <- buf[:cap(buf)]
+	}
+}
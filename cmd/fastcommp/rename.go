@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// nameFile gives the input file called name, described by fi, the name of
+// its v1 piece CID and extension: in place with --rename, and as a hardlink
+// in --link-dir. It returns the path of the file so named, the link if both
+// are given, or "" with neither.
+func nameFile(name string, fi os.FileInfo, sum fastcommp.DataCIDSize) (string, error) {
+	if fi == nil || !fi.Mode().IsRegular() {
+		return "", nil
+	}
+	base := sum.PieceCID.String() + filepath.Ext(name)
+
+	var path string
+	if opts.Rename {
+		path = filepath.Join(filepath.Dir(name), base)
+		if err := placeFile(os.Rename, name, path, fi); err != nil {
+			return "", xerrors.Errorf("renaming to the piece CID: %w", err)
+		}
+		// the sidecar follows its file
+		if opts.Sidecar && path != name {
+			if err := os.Rename(name+sidecarExt, path+sidecarExt); err != nil {
+				return "", xerrors.Errorf("renaming sidecar: %w", err)
+			}
+		}
+		name = path
+	}
+	if opts.LinkDir != "" {
+		path = filepath.Join(opts.LinkDir, base)
+		if err := placeFile(os.Link, name, path, fi); err != nil {
+			return "", xerrors.Errorf("linking into --link-dir: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// placeFile puts the file called name, described by fi, at path with op,
+// os.Rename or os.Link, unless it is there already. Another file in the way
+// is left alone and reported.
+func placeFile(op func(oldname, newname string) error, name, path string, fi os.FileInfo) error {
+	if existing, err := os.Stat(path); err == nil {
+		if os.SameFile(fi, existing) {
+			return nil
+		}
+		return xerrors.Errorf("%s already exists", path)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return op(name, path)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// maxBackoff caps the delay between two attempts
+const maxBackoff = 30 * time.Second
+
+// statusError is an unsuccessful HTTP response
+type statusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("fetching %s: %s", e.url, e.status)
+}
+
+// HTTPStatusCode matches the method of AWS SDK response errors
+func (e *statusError) HTTPStatusCode() int {
+	return e.code
+}
+
+// transient reports whether err is worth retrying: timeouts, dropped
+// connections, truncated bodies and 5xx responses
+func transient(err error) bool {
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		return status.HTTPStatusCode() >= 500
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// backoff is the delay before retry number attempt, starting at 1
+func backoff(attempt int) time.Duration {
+	d := opts.RetryBackoff << (attempt - 1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// withRetry calls fn until it succeeds, fails permanently or has failed
+// opts.Retries times in a row after the first attempt
+func withRetry(fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !transient(err) || attempt > opts.Retries {
+			return err
+		}
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// resumingReader reads a remote payload, reopening it at the current offset
+// with a range request when the connection fails transiently
+type resumingReader struct {
+	rc     io.ReadCloser
+	resume func(off int64) (io.ReadCloser, error)
+	off    int64
+	// failures counts the consecutive failed reads without progress
+	failures int
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.off += int64(n)
+	if n > 0 {
+		r.failures = 0
+	}
+	if err == nil || err == io.EOF || !transient(err) {
+		return n, err
+	}
+	r.failures++
+	if r.failures > opts.Retries {
+		return n, err
+	}
+
+	// reopen at the offset reached so far; the next Read continues there
+	time.Sleep(backoff(r.failures))
+	r.rc.Close()
+	if rerr := withRetry(func() error {
+		rc, err := r.resume(r.off)
+		if err == nil {
+			r.rc = rc
+		}
+		return err
+	}); rerr != nil {
+		return n, xerrors.Errorf("resuming at offset %d after %v: %w", r.off, err, rerr)
+	}
+	return n, nil
+}
+
+func (r *resumingReader) Close() error {
+	return r.rc.Close()
+}
+
+// retryReaderAt retries the failed ranged reads of a remote payload
+type retryReaderAt struct {
+	at io.ReaderAt
+}
+
+func (r retryReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	err := withRetry(func() error {
+		var err error
+		n, err = r.at.ReadAt(p, off)
+		return err
+	})
+	return n, err
+}
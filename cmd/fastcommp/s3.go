@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/xerrors"
+)
+
+// awsConfig loads the shared AWS configuration once, from the standard
+// credential chain: environment, shared config files, SSO and instance roles
+var awsConfig = sync.OnceValues(func() (aws.Config, error) {
+	return config.LoadDefaultConfig(context.Background())
+})
+
+// openS3 streams the object s3://bucket/key. When no region is configured,
+// the bucket's region is discovered first.
+func openS3(u *url.URL) (input, error) {
+	ctx := context.Background()
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return input{}, xerrors.Errorf("invalid S3 URL %s, expected s3://bucket/key", u)
+	}
+
+	cfg, err := awsConfig()
+	if err != nil {
+		return input{}, xerrors.Errorf("loading AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		region, err := manager.GetBucketRegion(ctx, s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.Region = "us-east-1"
+		}), bucket)
+		if err != nil {
+			return input{}, xerrors.Errorf("discovering region of bucket %s: %w", bucket, err)
+		}
+		cfg = cfg.Copy()
+		cfg.Region = region
+	}
+
+	client := s3.NewFromConfig(cfg)
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return input{}, xerrors.Errorf("getting %s: %w", u, err)
+	}
+	in := input{ReadCloser: out.Body, size: -1}
+	if out.ContentLength != nil {
+		in.size = *out.ContentLength
+		at := s3ReaderAt{client: client, bucket: bucket, key: key}
+		in.at = at
+		in.resume = at.from
+	}
+	return in, nil
+}
+
+// s3ReaderAt reads byte ranges of an S3 object with ranged GetObject calls
+type s3ReaderAt struct {
+	client      *s3.Client
+	bucket, key string
+}
+
+// ReadAt fetches len(p) bytes at off with a single ranged GetObject
+func (s s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)),
+	})
+	if err != nil {
+		return 0, xerrors.Errorf("getting range at %d of s3://%s/%s: %w", off, s.bucket, s.key, err)
+	}
+	defer out.Body.Close()
+	return io.ReadFull(out.Body, p)
+}
+
+// from streams the rest of the object from offset off
+func (s s3ReaderAt) from(off int64) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", off)),
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("getting s3://%s/%s from offset %d: %w", s.bucket, s.key, off, err)
+	}
+	return out.Body, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// padToSector reports whether --sector-size or --proof-type pad the pieces
+// to a whole sector
+func padToSector() bool {
+	return opts.SectorSize > 0 || opts.ProofType != ""
+}
+
+// checkTargetSize checks the --target-piece-size, which pads the pieces like
+// --sector-size does, to any piece size
+func checkTargetSize() error {
+	if opts.TargetSize == 0 {
+		return nil
+	}
+	if padToSector() {
+		return xerrors.New("--target-piece-size pads to a piece size, --sector-size and --proof-type to a sector: pick one")
+	}
+	if err := abi.PaddedPieceSize(opts.TargetSize).Validate(); err != nil {
+		return xerrors.Errorf("invalid --target-piece-size %s, expected a power of two of 128B or more, such as 32GiB", formatSize(int64(opts.TargetSize)))
+	}
+	return nil
+}
+
+// sealProof returns the seal proof of the --proof-type, or else of the
+// --sector-size
+func sealProof() (abi.RegisteredSealProof, error) {
+	if opts.ProofType != "" {
+		p, err := fastcommp.ParseSealProof(opts.ProofType)
+		if err != nil {
+			return 0, xerrors.Errorf("invalid --proof-type: %w", err)
+		}
+		if ss, _ := p.SectorSize(); opts.SectorSize > 0 && int64(ss) != int64(opts.SectorSize) {
+			return 0, xerrors.Errorf("--proof-type %s seals sectors of %s, not the --sector-size %s", opts.ProofType, formatSize(int64(ss)), formatSize(int64(opts.SectorSize)))
+		}
+		return p, nil
+	}
+	p, err := fastcommp.SealProofOf(abi.SectorSize(opts.SectorSize))
+	if err != nil {
+		return 0, xerrors.Errorf("invalid --sector-size %s, expected 2KiB, 8MiB, 512MiB, 32GiB or 64GiB", formatSize(int64(opts.SectorSize)))
+	}
+	return p, nil
+}
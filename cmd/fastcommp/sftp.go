@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/xerrors"
+)
+
+// remoteReader is a remote file whose Close also tears down the connection
+// it was opened on
+type remoteReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *remoteReader) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// remoteUser returns the user name and password for u. The password comes
+// from the URL or else from --password-file.
+func remoteUser(u *url.URL) (string, string, error) {
+	user := u.User.Username()
+	if pass, ok := u.User.Password(); ok {
+		return user, pass, nil
+	}
+	if opts.PasswordFile == "" {
+		return user, "", nil
+	}
+	pass, err := ioutil.ReadFile(opts.PasswordFile)
+	if err != nil {
+		return "", "", xerrors.Errorf("reading password file: %w", err)
+	}
+	return user, strings.TrimRight(string(pass), "\r\n"), nil
+}
+
+// openSFTP streams the file at sftp://[user@]host[:port]/path. A path starting
+// with /~/ is relative to the remote home directory. The server's host key
+// must be listed in ~/.ssh/known_hosts.
+func openSFTP(u *url.URL) (input, error) {
+	user, pass, err := remoteUser(u)
+	if err != nil {
+		return input{}, err
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	auth, err := sshAuth(pass)
+	if err != nil {
+		return input{}, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return input{}, err
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return input{}, xerrors.Errorf("loading known hosts: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "22")
+	}
+	conn, err := ssh.Dial("tcp", host, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return input{}, xerrors.Errorf("connecting to %s: %w", host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return input{}, xerrors.Errorf("starting sftp session: %w", err)
+	}
+
+	path := u.Path
+	if strings.HasPrefix(path, "/~/") {
+		path = path[len("/~/"):]
+	}
+	f, err := client.Open(path)
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return input{}, xerrors.Errorf("opening %s: %w", path, err)
+	}
+	size := int64(-1)
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		size = fi.Size()
+	}
+	return input{ReadCloser: &remoteReader{Reader: f, closers: []io.Closer{f, client, conn}}, size: size}, nil
+}
+
+// sshAuth returns the SSH authentication methods to try: the --ssh-key
+// private key, the keys of a running ssh-agent and the password, if any
+func sshAuth(pass string) ([]ssh.AuthMethod, error) {
+	var auth []ssh.AuthMethod
+	if opts.SSHKey != "" {
+		pem, err := ioutil.ReadFile(opts.SSHKey)
+		if err != nil {
+			return nil, xerrors.Errorf("reading SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing SSH key %s: %w", opts.SSHKey, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if pass != "" {
+		auth = append(auth, ssh.Password(pass))
+	}
+	return auth, nil
+}
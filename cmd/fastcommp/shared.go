@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+)
+
+// appendRecord appends rec as a line of JSON to the --append-manifest at
+// path, under an exclusive lock so that concurrent runs do not interleave.
+// A file replaced by compact meanwhile is opened again.
+func appendRecord(path string, rec flatRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	// each record of a .jsonl.gz or .jsonl.zst manifest is a gzip member or
+	// zstd frame of its own, which the readers take as one stream
+	if line, err = compressBytes(compressionOf(path), append(line, '\n')); err != nil {
+		return err
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return err
+		}
+		if !samePath(f, path) {
+			f.Close()
+			continue
+		}
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// samePath reports whether f is still the file at path
+func samePath(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
+}
+
+// runCompact rewrites a manifest grown by --append-manifest as a single
+// --manifest document, with one record per path and the totals
+func runCompact(args []string) int {
+	var copts struct {
+		Help   bool   `getopt:"--help -h display this help"`
+		Output string `getopt:"--output -o=FILE write the manifest to FILE instead of replacing MANIFEST"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp compact")
+	set.SetParameters("MANIFEST")
+	options.RegisterSet("compact", &copts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if copts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 1 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	path := args[0]
+	out := copts.Output
+	if out == "" {
+		out = path
+	}
+
+	// hold the lock until the manifest is replaced, so that no record is
+	// appended to the old file in between
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitIO
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: locking manifest:", err)
+		return exitIO
+	}
+	records, err := decodeRecords(f, path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitIO
+	}
+	n := len(records)
+	records = latestRecords(records)
+	if err := compactManifest(records).write(out, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing manifest %s: %s\n", out, err)
+		return exitIO
+	}
+	fmt.Fprintf(os.Stderr, "Compacted %d records into %d files\n", n, len(records))
+	return exitOK
+}
+
+// latestRecords keeps the last record of each path, or its last successful
+// one when it was hashed successfully before failing, sorted by path
+func latestRecords(records []flatRecord) []flatRecord {
+	latest := make(map[string]flatRecord, len(records))
+	for _, rec := range records {
+		if prev, ok := latest[rec.Path]; ok && rec.Error != "" && prev.Error == "" {
+			continue
+		}
+		latest[rec.Path] = rec
+	}
+	kept := make([]flatRecord, 0, len(latest))
+	for _, rec := range latest {
+		kept = append(kept, rec)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Path < kept[j].Path
+	})
+	return kept
+}
+
+// compactManifest returns the manifest of records from many runs, whose
+// duration spans from the start of the first input to the end of the last
+func compactManifest(records []flatRecord) manifest {
+	m := manifest{SchemaVersion: schemaVersion, Files: records}
+	var first, last time.Time
+	for _, rec := range records {
+		m.Totals.Files++
+		if rec.Error != "" {
+			m.Totals.Failed++
+		} else {
+			m.Totals.PayloadSize += rec.PayloadSize
+			m.Totals.PieceSize += rec.PieceSize
+		}
+		start := rec.Completed.Add(-time.Duration(rec.Duration * float64(time.Second)))
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if rec.Completed.After(last) {
+			last = rec.Completed
+		}
+	}
+	m.Totals.Duration = last.Sub(first).Seconds()
+	return m
+}
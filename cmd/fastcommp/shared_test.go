@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendManifest(t *testing.T) {
+	const writers, each = 8, 50
+	for _, name := range []string{"shared.jsonl", "shared.jsonl.gz"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := appendRecord(path, flatRecord{Version: schemaVersion, Path: "first"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// concurrent runs append while the manifest is compacted under them
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*each+1)
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < each; i++ {
+					rec := flatRecord{Version: schemaVersion, Path: fmt.Sprintf("w%d/%03d", w, i), PieceCID: "baga"}
+					if err := appendRecord(path, rec); err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+		}
+		done := make(chan struct{})
+		compacted := make(chan struct{})
+		go func() {
+			defer close(compacted)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if status := runCompact([]string{"compact", path}); status != exitOK {
+					errs <- fmt.Errorf("compact exited with %d", status)
+					return
+				}
+			}
+		}()
+		wg.Wait()
+		close(done)
+		<-compacted
+		close(errs)
+		for err := range errs {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		// no record is lost or torn, whether it went to the old file or the
+		// compacted one
+		records, err := readRecords(path)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		seen := map[string]bool{}
+		for _, rec := range records {
+			seen[rec.Path] = true
+		}
+		if len(seen) != writers*each+1 {
+			t.Errorf("%s: %d of %d paths left", name, len(seen), writers*each+1)
+		}
+
+		if status := runCompact([]string{"compact", path}); status != exitOK {
+			t.Fatalf("%s: compact exited with %d", name, status)
+		}
+		if records, err = readRecords(path); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != writers*each+1 {
+			t.Errorf("%s: compacted into %d records, want %d", name, len(records), writers*each+1)
+		}
+	}
+}
+
+func TestCompactManifest(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ok := func(path, piece string, at time.Duration) flatRecord {
+		return flatRecord{Path: path, PieceCID: piece, PayloadSize: 1000, PieceSize: 1024, Duration: 1, Completed: start.Add(at)}
+	}
+	failed := func(path string, at time.Duration) flatRecord {
+		return flatRecord{Path: path, Error: "boom", ErrorCode: codeFailed, Duration: 1, Completed: start.Add(at)}
+	}
+	records := latestRecords([]flatRecord{
+		ok("b", "baga-1", time.Second),
+		failed("b", 5*time.Second), // a later failure keeps the earlier piece
+		failed("a", 2*time.Second), // a later success replaces a failure
+		ok("a", "baga-2", 3*time.Second),
+		ok("c", "baga-3", 4*time.Second),
+		ok("c", "baga-4", 10*time.Second), // the latest piece wins
+		failed("d", 6*time.Second),
+	})
+	want := []flatRecord{ok("a", "baga-2", 3*time.Second), ok("b", "baga-1", time.Second), ok("c", "baga-4", 10*time.Second), failed("d", 6*time.Second)}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("got %+v, want %+v", records, want)
+	}
+
+	// the duration spans from the start of b to the end of c
+	m := compactManifest(records)
+	if wantTotals := (manifestTotals{Files: 4, Failed: 1, PayloadSize: 3000, PieceSize: 3072, Duration: 10}); m.Totals != wantTotals {
+		t.Errorf("totals %+v, want %+v", m.Totals, wantTotals)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// sidecarExt is appended to the name of an input to name its --sidecar
+const sidecarExt = ".commp.json"
+
+// sidecar is the --sidecar file written next to a local input, holding its
+// piece and the size and mtime the source file had when it was hashed
+type sidecar struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	PieceCID      string    `json:"pieceCid"`
+	PieceSize     uint64    `json:"pieceSize"`
+	PayloadSize   int64     `json:"payloadSize"`
+	FileSize      int64     `json:"fileSize"`
+	Mtime         time.Time `json:"mtime"`
+	// Decompressed is set when the piece is of the decompressed file
+	Decompressed bool `json:"decompressed,omitempty"`
+}
+
+// writeSidecar writes the sidecar of the input called name, described by fi,
+// with its v1 piece CID in sum, replacing any previous one atomically
+func writeSidecar(name string, fi os.FileInfo, sum fastcommp.DataCIDSize) error {
+	data, err := json.MarshalIndent(sidecar{
+		SchemaVersion: schemaVersion,
+		PieceCID:      sum.PieceCID.String(),
+		PieceSize:     uint64(sum.PieceSize),
+		PayloadSize:   sum.PayloadSize,
+		FileSize:      fi.Size(),
+		Mtime:         fi.ModTime(),
+		Decompressed:  decompressed(name),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := createAtomic(name+sidecarExt, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
+
+// readSidecar returns the sum in the sidecar of the input called name, unless
+// the size and mtime it records do not match fi, or it is of the
+// decompressed file and this run hashes it as stored or the other way around
+func readSidecar(name string, fi os.FileInfo, writerOpts []fastcommp.Option) (fastcommp.DataCIDSize, error) {
+	data, err := os.ReadFile(name + sidecarExt)
+	if err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	var sc sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	if sc.FileSize != fi.Size() || !sc.Mtime.Equal(fi.ModTime()) || sc.Decompressed != decompressed(name) {
+		return fastcommp.DataCIDSize{}, xerrors.New("stale sidecar")
+	}
+	pieceCID, err := cid.Decode(sc.PieceCID)
+	if err != nil {
+		return fastcommp.DataCIDSize{}, err
+	}
+	return fastcommp.NewDataCIDSize(pieceCID, sc.PayloadSize, abi.PaddedPieceSize(sc.PieceSize), writerOpts...)
+}
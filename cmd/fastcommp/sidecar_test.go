@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/application-research/fastcommp"
+)
+
+// sameSum reports whether a stored sum read back as got is the sum want
+func sameSum(got, want fastcommp.DataCIDSize) bool {
+	return got.PieceCID.Equals(want.PieceCID) && got.PayloadSize == want.PayloadSize && got.PieceSize == want.PieceSize &&
+		bytes.Equal(got.PieceCommitment, want.PieceCommitment) && got.SectorSize == want.SectorSize
+}
+
+func TestSidecar(t *testing.T) {
+	saveOpts(t)
+	payload := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(payload)
+	path := filepath.Join(t.TempDir(), "payload.bin")
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fastcommp.SumBytes(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSidecar(path, fi, sum); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path + sidecarExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sc sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		t.Fatal(err)
+	}
+	want := sidecar{SchemaVersion: schemaVersion, PieceCID: sum.PieceCID.String(), PieceSize: uint64(sum.PieceSize),
+		PayloadSize: 5000, FileSize: 5000, Mtime: fi.ModTime()}
+	if !sc.Mtime.Equal(want.Mtime) || sc.PieceCID != want.PieceCID || sc.PieceSize != want.PieceSize ||
+		sc.PayloadSize != want.PayloadSize || sc.FileSize != want.FileSize || sc.SchemaVersion != want.SchemaVersion || sc.Decompressed {
+		t.Errorf("sidecar %+v, want %+v", sc, want)
+	}
+
+	got, err := readSidecar(path, fi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameSum(got, sum) {
+		t.Errorf("read back %+v, want %+v", got, sum)
+	}
+
+	// a changed file, or one hashed differently, makes the sidecar stale
+	if _, err := readSidecar(path, fi, []fastcommp.Option{fastcommp.WithTargetPieceSize(1 << 20)}); err == nil {
+		t.Error("sidecar of an unpadded piece read back for a target piece size")
+	}
+	opts.Decompress = true
+	if _, err := readSidecar(path, fi, nil); err == nil {
+		t.Error("sidecar of the stored bytes read back with --decompress")
+	}
+	opts.Decompress = false
+	if err := os.Chtimes(path, time.Now(), fi.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if touched, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if _, err := readSidecar(path, touched, nil); err == nil {
+		t.Error("sidecar read back after the mtime changed")
+	}
+	if err := os.WriteFile(path, append(payload, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if grown, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if _, err := readSidecar(path, grown, nil); err == nil {
+		t.Error("sidecar read back after the size changed")
+	}
+
+	if err := os.WriteFile(path+sidecarExt, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSidecar(path, fi, nil); err == nil {
+		t.Error("corrupt sidecar read back")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// sigExt is appended to the --manifest path for its --sign-key signature
+const sigExt = ".sig"
+
+// loadSigningKey reads the ed25519 private key of --sign-key, PEM-encoded as
+// PKCS #8 like `openssl genpkey -algorithm ed25519` writes it
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("reading --sign-key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, xerrors.Errorf("--sign-key %s is not a PEM-encoded PKCS #8 private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing --sign-key %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, xerrors.Errorf("--sign-key %s is a %T, not an ed25519 key", path, key)
+	}
+	return ed, nil
+}
+
+// writeSignature writes the raw 64-byte ed25519 signature of data by key to
+// path, replacing it atomically
+func writeSignature(path string, data []byte, key ed25519.PrivateKey) error {
+	f, err := createAtomic(path, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(ed25519.Sign(key, data)); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
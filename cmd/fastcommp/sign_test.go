@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKey writes key to a PEM-encoded PKCS #8 file in dir and returns its
+// path
+func writeKey(t *testing.T, dir string, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// verifyFile reports whether sigPath holds the signature of the file at path
+// by pub
+func verifyFile(t *testing.T, pub ed25519.PublicKey, path, sigPath string) bool {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := os.ReadFile(sigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(sig) == ed25519.SignatureSize && ed25519.Verify(pub, data, sig)
+}
+
+func TestSignedManifest(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := loadSigningKey(writeKey(t, dir, priv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(priv) {
+		t.Fatal("loaded another key")
+	}
+
+	records := []flatRecord{{Version: schemaVersion, Path: "a.bin", PayloadSize: 1000, PieceSize: 1024, PieceCID: "baga-a"}}
+	for _, name := range []string{"manifest.json", "manifest.json.gz"} {
+		path := filepath.Join(dir, name)
+		if err := writeManifest(path, records, summary{files: 1}, key); err != nil {
+			t.Fatal(err)
+		}
+		// the signature is of the file as stored, compressed or not
+		if !verifyFile(t, pub, path, path+sigExt) {
+			t.Errorf("%s: signature does not verify", name)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)/2] ^= 1
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if verifyFile(t, pub, path, path+sigExt) {
+			t.Errorf("%s: signature verifies a tampered manifest", name)
+		}
+	}
+
+	// only PEM-encoded ed25519 keys are accepted
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSigningKey(writeKey(t, dir, ec)); err == nil {
+		t.Error("loaded an ECDSA key")
+	}
+	notPEM := filepath.Join(dir, "key.der")
+	if err := os.WriteFile(notPEM, priv, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSigningKey(notPEM); err == nil {
+		t.Error("loaded a raw key")
+	}
+}
+
+func TestSignedBatch(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := writeKey(t, dir, priv)
+	a, b := filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")
+	for _, name := range []string{a, b} {
+		if err := os.WriteFile(name, []byte(name+" is a payload long enough to have a piece commitment"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "manifest.json")
+	if _, stderr, status := runMain(t, "-q", "--manifest", path, "--sign-key", keyPath, a, b); status != exitOK {
+		t.Fatalf("exit status %d: %s", status, stderr)
+	}
+	if !verifyFile(t, pub, path, path+sigExt) {
+		t.Error("signature does not verify")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 2 || m.Totals.Files != 2 || m.Totals.Failed != 0 {
+		t.Errorf("manifest %+v", m)
+	}
+
+	// a key needs a manifest to sign
+	if _, _, status := runMain(t, "-q", "--sign-key", keyPath, a, b); status != exitUsage {
+		t.Errorf("--sign-key without --manifest: exit status %d, want %d", status, exitUsage)
+	}
+}
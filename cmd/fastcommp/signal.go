@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// job is an input being hashed, as reported by the status signal
+type job struct {
+	path   string
+	size   int64 // negative if not known up front
+	start  time.Time
+	base   atomic.Int64 // bytes restored from --state
+	hashed atomic.Int64
+}
+
+// running lists the jobs in flight, in the order they started
+var running struct {
+	sync.Mutex
+	jobs []*job
+}
+
+// startJob registers a job for path of size bytes. The returned option
+// reports its progress; stop removes it again.
+func startJob(path string, size int64) (j *job, progress fastcommp.Option, stop func()) {
+	j = &job{path: path, size: size, start: time.Now()}
+	running.Lock()
+	running.jobs = append(running.jobs, j)
+	running.Unlock()
+
+	progress = fastcommp.WithProgress(func(bytesHashed int64, leavesDone int) {
+		j.hashed.Store(bytesHashed)
+	})
+	stop = func() {
+		running.Lock()
+		defer running.Unlock()
+		for i, r := range running.jobs {
+			if r == j {
+				running.jobs = append(running.jobs[:i], running.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	return j, progress, stop
+}
+
+// progress returns the offset j has hashed up to
+func (j *job) progress() int64 {
+	hashed, base := j.hashed.Load(), j.base.Load()
+	if hashed < base {
+		hashed = base
+	}
+	return hashed
+}
+
+// status describes how far j has got: the offset hashed up to, the
+// throughput since it started and, if its size is known, the time left
+func (j *job) status() string {
+	hashed, base := j.progress(), j.base.Load()
+	elapsed := time.Since(j.start)
+	s := fmt.Sprintf("%s: %s hashed", j.path, formatSize(hashed))
+	if j.size > 0 {
+		s += fmt.Sprintf(" of %s (%.1f%%)", formatSize(j.size), float64(hashed)*100/float64(j.size))
+	}
+	s += ", " + throughput(hashed-base, elapsed)
+	if rate := float64(hashed-base) / elapsed.Seconds(); j.size > 0 && rate > 0 {
+		eta := time.Duration(float64(j.size-hashed) / rate * float64(time.Second))
+		s += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	return s
+}
+
+// interrupted is closed on SIGINT or SIGTERM with --state, to make the
+// writer stop reading and save its progress
+var interrupted = make(chan struct{})
+
+var errInterrupted = xerrors.New("interrupted")
+
+// savedError is an input interrupted after n bytes, with its progress saved
+// to --state
+type savedError struct {
+	n int64
+}
+
+func (e savedError) Error() string {
+	return fmt.Sprintf("interrupted after %d bytes, run again with --state %s to resume", e.n, opts.State)
+}
+
+func (savedError) Unwrap() error {
+	return errInterrupted
+}
+
+// handleSignals prints the status of every job in flight to stderr on each
+// status signal and, with --state, turns the first SIGINT or SIGTERM into a
+// checkpoint. A second one kills the process as usual.
+func handleSignals() {
+	if len(statusSignals) > 0 {
+		usr := make(chan os.Signal, 1)
+		signal.Notify(usr, statusSignals...)
+		go func() {
+			for range usr {
+				running.Lock()
+				for _, j := range running.jobs {
+					fmt.Fprintln(stderr, j.status())
+				}
+				running.Unlock()
+			}
+		}()
+	}
+
+	if opts.State != "" {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-stop
+			signal.Stop(stop)
+			fmt.Fprintf(stderr, "%s, saving progress to %s\n", sig, opts.State)
+			close(interrupted)
+		}()
+	}
+}
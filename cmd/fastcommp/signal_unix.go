@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals make the jobs in flight print their progress
+var statusSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+package main
+
+import (
+	"os"
+)
+
+// statusSignals is empty, as Windows has no SIGUSR1
+var statusSignals []os.Signal
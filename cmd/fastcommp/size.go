@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pborman/getopt/v2"
+	"golang.org/x/xerrors"
+)
+
+// byteSize is a size option given in bytes or with a unit, like 512KiB, 16M
+// or 2GiB. Units are powers of 1024.
+type byteSize int64
+
+// sizeUnits are the accepted units, longest first
+var sizeUnits = []struct {
+	suffix string
+	shift  uint
+}{
+	{"kib", 10}, {"mib", 20}, {"gib", 30}, {"tib", 40},
+	{"kb", 10}, {"mb", 20}, {"gb", 30}, {"tb", 40},
+	{"k", 10}, {"m", 20}, {"g", 30}, {"t", 40},
+	{"b", 0},
+}
+
+func (s *byteSize) Set(value string, _ getopt.Option) error {
+	num, shift := strings.ToLower(strings.TrimSpace(value)), uint(0)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(num, u.suffix) {
+			num, shift = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)>>shift {
+		return xerrors.Errorf("invalid size %q", value)
+	}
+	*s = byteSize(n << shift)
+	return nil
+}
+
+func (s *byteSize) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+// formatSize formats n bytes with the largest binary unit that fits
+func formatSize(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		shift  uint
+	}{{"TiB", 40}, {"GiB", 30}, {"MiB", 20}, {"KiB", 10}} {
+		if n >= 1<<u.shift {
+			return strconv.FormatFloat(float64(n)/float64(int64(1)<<u.shift), 'f', 1, 64) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/xerrors"
+)
+
+// sliceInput narrows in to the --length bytes starting at --offset. Local
+// files seek and remote sources with range support reopen at the offset;
+// anything else reads and discards the bytes before it.
+func sliceInput(in input) (input, error) {
+	off, n, err := inputRange(in.size)
+	if err != nil {
+		return input{}, err
+	}
+
+	if err := skipTo(in.ReadCloser, off); err != nil {
+		return input{}, err
+	}
+	if in.at != nil && n >= 0 {
+		in.at = io.NewSectionReader(in.at, off, n)
+	}
+	if n >= 0 {
+		in.ReadCloser = &limitedReader{LimitedReader: &io.LimitedReader{R: in.ReadCloser, N: n}, rc: in.ReadCloser, start: off, size: n}
+	}
+	in.size = n
+	return in, nil
+}
+
+// inputRange returns the offset and length selected by --offset and --length
+// for an input of size bytes, or of unknown size if negative. The length is
+// negative for the rest of an input of unknown size.
+func inputRange(size int64) (int64, int64, error) {
+	off, n := opts.Offset, opts.Length
+	if off < 0 {
+		return 0, 0, xerrors.Errorf("invalid offset %d", off)
+	}
+	if size >= 0 {
+		if n < 0 {
+			n = size - off
+		}
+		if off+n > size {
+			return 0, 0, xerrors.Errorf("range of %d bytes at offset %d exceeds the %d-byte input", n, off, size)
+		}
+	}
+	return off, n, nil
+}
+
+// skipTo advances r, which has not been read from, to off
+func skipTo(r io.Reader, off int64) error {
+	if off == 0 {
+		return nil
+	}
+	if ok, err := seekTo(r, off); ok || err != nil {
+		return err
+	}
+	if skipped, err := io.CopyN(ioutil.Discard, r, off); err != nil {
+		return xerrors.Errorf("skipping to offset %d, reached %d: %w", off, skipped, err)
+	}
+	return nil
+}
+
+// seekTo moves r to off without reading the bytes before it, and reports
+// whether r could
+func seekTo(r io.Reader, off int64) (bool, error) {
+	switch r := r.(type) {
+	case *limitedReader:
+		// a slice moves within the input it was cut from
+		if off > r.size {
+			return false, xerrors.Errorf("offset %d is past the %d-byte range", off, r.size)
+		}
+		ok, err := seekTo(r.rc, r.start+off)
+		if ok {
+			r.N = r.size - off
+		}
+		return ok, err
+	case io.Seeker:
+		// pipes and character devices cannot seek and are read instead
+		_, err := r.Seek(off, io.SeekStart)
+		return err == nil, nil
+	case *resumingReader:
+		var rc io.ReadCloser
+		if err := withRetry(func() error {
+			var err error
+			rc, err = r.resume(off)
+			return err
+		}); err != nil {
+			return false, xerrors.Errorf("reopening at offset %d: %w", off, err)
+		}
+		r.rc.Close()
+		r.rc, r.off = rc, off
+		return true, nil
+	}
+	return false, nil
+}
+
+// limitedReader reads the size bytes at start of an input
+type limitedReader struct {
+	*io.LimitedReader
+	rc          io.ReadCloser
+	start, size int64
+}
+
+func (r *limitedReader) Close() error {
+	return r.rc.Close()
+}
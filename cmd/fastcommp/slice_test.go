@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countingFile counts the bytes read from a file
+type countingFile struct {
+	*os.File
+	read int64
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+func TestSliceResume(t *testing.T) {
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(off, n int64) { opts.Offset, opts.Length = off, n }(opts.Offset, opts.Length)
+	opts.Offset, opts.Length = 1000, 5000
+
+	for _, tc := range []struct {
+		name     string
+		seekable bool
+		resumed  int64
+	}{
+		{"file", true, 0},
+		{"file resumed", true, 2032},
+		{"file resumed at the end", true, 5000},
+		{"pipe resumed", false, 2032},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			cf := &countingFile{File: f}
+			in := input{ReadCloser: cf, size: int64(len(data)), file: f}
+			if !tc.seekable {
+				in = input{ReadCloser: io.NopCloser(cf), size: -1}
+			}
+			sliced, err := sliceInput(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := skipTo(sliced.ReadCloser, tc.resumed); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(sliced)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := data[opts.Offset+tc.resumed : opts.Offset+opts.Length]
+			if !bytes.Equal(got, want) {
+				t.Errorf("read %d bytes, expected %d of the range", len(got), len(want))
+			}
+			// a file seeks to the resumed offset instead of reading up to it
+			if tc.seekable && cf.read != int64(len(want)) {
+				t.Errorf("read %d bytes of the file for %d of the range", cf.read, len(want))
+			}
+		})
+	}
+
+	// a slice cannot be resumed past its end
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sliced, err := sliceInput(input{ReadCloser: &countingFile{File: f}, size: int64(len(data)), file: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := skipTo(sliced.ReadCloser, opts.Length+1); err == nil {
+		t.Errorf("resumed past the end of the range")
+	}
+}
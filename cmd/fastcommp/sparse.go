@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// hashSparse hashes the sparse local file f of size bytes, reading only its
+// data extents and writing its holes to the writer as zeros, which take the
+// precomputed commitment of a zero leaf. ok is false, and the file is to be
+// read as usual, if it has no holes or they cannot be found.
+func hashSparse(ctx context.Context, res result, f *os.File, size int64, writerOpts []fastcommp.Option) (result, bool, error) {
+	if !sparse(f, size) {
+		return res, false, nil
+	}
+	off, n, err := inputRange(size)
+	if err != nil {
+		return res, true, xerrors.Errorf("opening input: %w", err)
+	}
+
+	w, err := fastcommp.NewCommpWriter(writerOpts...)
+	if err != nil {
+		return res, true, err
+	}
+	defer w.Close()
+
+	start := time.Now()
+	for pos, end := off, off+n; pos < end; {
+		data, hole, err := nextData(f, pos, end)
+		if err != nil {
+			return res, true, xerrors.Errorf("finding data in %s: %w", f.Name(), err)
+		}
+		if _, err := w.WriteZeros(data - pos); err != nil {
+			return res, true, xerrors.Errorf("reading input: %w", err)
+		}
+		r := &meteredReader{r: io.NewSectionReader(f, data, hole-data)}
+		if _, err := readAhead(ctx, w, r); err != nil {
+			return res, true, xerrors.Errorf("reading input: %w", err)
+		}
+		if r.n != hole-data {
+			return res, true, xerrors.Errorf("read %d bytes at offset %d, expected %d", r.n, data, hole-data)
+		}
+		res.read += r.elapsed
+		res.readBytes += r.n
+		pos = hole
+	}
+	sum, err := w.SumContext(ctx)
+	if err != nil {
+		return res, true, xerrors.Errorf("calculating commP: %w", err)
+	}
+	res.DataCIDSize = sum
+	res.elapsed = time.Since(start)
+	return res, true, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sparse reports whether the file f of size bytes occupies fewer blocks on
+// disk than its size needs, so it has holes
+func sparse(f *os.File, size int64) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Blocks*512 < size
+}
+
+// nextData returns the next extent of data in f at or after pos, as the
+// offsets where the data starts and where the hole after it starts, both
+// capped at end
+func nextData(f *os.File, pos, end int64) (int64, int64, error) {
+	data, err := unix.Seek(int(f.Fd()), pos, unix.SEEK_DATA)
+	if err == unix.ENXIO || data > end {
+		// only a hole is left
+		return end, end, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	hole, err := unix.Seek(int(f.Fd()), data, unix.SEEK_HOLE)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hole > end {
+		hole = end
+	}
+	return data, hole, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+)
+
+// sparse reports false, as holes are only looked for on Linux
+func sparse(f *os.File, size int64) bool {
+	return false
+}
+
+// nextData is only called for sparse files
+func nextData(f *os.File, pos, end int64) (int64, int64, error) {
+	return pos, end, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// splitManifest is the reassembly manifest written by split: the chunks of
+// the input in order, which concatenated give it back
+type splitManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Input         string       `json:"input"`
+	PayloadSize   int64        `json:"payloadSize"`
+	MaxPieceSize  uint64       `json:"maxPieceSize"`
+	Chunks        []splitChunk `json:"chunks"`
+}
+
+// splitChunk is a chunk of a split input, at Offset in it
+type splitChunk struct {
+	Index     int    `json:"index"`
+	Offset    int64  `json:"offset"`
+	Size      int64  `json:"size"`
+	PieceCID  string `json:"pieceCid"`
+	PieceSize uint64 `json:"pieceSize"`
+	Path      string `json:"path,omitempty"`
+}
+
+// runSplit divides INPUT into chunks that each fill at most a piece of
+// --max-piece-size, computes the piece CID of each and writes the manifest
+// to reassemble them, for payloads larger than a sector
+func runSplit(args []string) int {
+	var sopts struct {
+		Help         bool     `getopt:"--help -h display this help"`
+		MaxPieceSize byteSize `getopt:"--max-piece-size=SIZE the largest piece of a chunk, a power of two such as 32GiB (default 32GiB)"`
+		Manifest     string   `getopt:"--manifest=FILE write the reassembly manifest to FILE (default: INPUT.split.json)"`
+		OutDir       string   `getopt:"--out-dir=DIR also write each chunk to DIR/NAME.INDEX, as the manifest lists them"`
+		Pad          bool     `getopt:"--pad pad the piece of every chunk to --max-piece-size, like --target-piece-size"`
+		Threads      int      `getopt:"--threads=N hash with N threads (default: GOMAXPROCS, which follows cgroup CPU quotas)"`
+		JSON         bool     `getopt:"--json print the manifest instead of a table"`
+	}
+	sopts.MaxPieceSize = 32 << 30
+	set := getopt.New()
+	set.SetProgram("fastcommp split")
+	set.SetParameters("INPUT")
+	options.RegisterSet("split", &sopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if sopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 1 {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	name := args[0]
+	maxPiece := abi.PaddedPieceSize(sopts.MaxPieceSize)
+	if err := maxPiece.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-piece-size %s, expected a power of two of 128B or more, such as 32GiB\n", formatSize(int64(sopts.MaxPieceSize)))
+		return exitUsage
+	}
+	if sopts.Manifest == "" {
+		if name == stdinName {
+			fmt.Fprintln(os.Stderr, "Error: --manifest is needed to split stdin")
+			return exitUsage
+		}
+		sopts.Manifest = filepath.Base(name) + ".split.json"
+	}
+	if sopts.Threads < 1 {
+		// GOMAXPROCS follows cgroup CPU quotas, unlike runtime.NumCPU
+		sopts.Threads = runtime.GOMAXPROCS(0)
+	}
+	if sopts.OutDir != "" {
+		if err := os.MkdirAll(sopts.OutDir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return exitIO
+		}
+	}
+
+	in, err := openInput(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitStatus(errorCode(err), exitIO)
+	}
+	defer in.Close()
+	sp := splitter{
+		in:       in,
+		maxPiece: maxPiece,
+		pad:      sopts.Pad,
+		dir:      sopts.OutDir,
+		base:     filepath.Base(name),
+		opts:     []fastcommp.Option{fastcommp.WithConcurrency(sopts.Threads), fastcommp.WithStreaming()},
+	}
+	m := splitManifest{SchemaVersion: schemaVersion, Input: name, MaxPieceSize: uint64(maxPiece)}
+	for {
+		chunk, err := sp.next(len(m.Chunks), m.PayloadSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: chunk %d at offset %d: %s\n", name, len(m.Chunks), m.PayloadSize, err)
+			return exitStatus(errorCode(err), exitFailed)
+		}
+		m.Chunks = append(m.Chunks, chunk)
+		m.PayloadSize += chunk.Size
+	}
+	if len(m.Chunks) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s is empty\n", name)
+		return exitFailed
+	}
+
+	data, _ := json.MarshalIndent(m, "", "  ")
+	data = append(data, '\n')
+	f, err := createAtomic(sopts.Manifest, 0644)
+	if err == nil {
+		if _, err = f.Write(data); err != nil {
+			f.abort()
+		} else {
+			err = f.commit()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: writing --manifest %s: %s\n", sopts.Manifest, err)
+		return exitIO
+	}
+
+	if sopts.JSON {
+		os.Stdout.Write(data)
+		return exitOK
+	}
+	fmt.Printf("Input:    %s, %d bytes (%s)\n", name, m.PayloadSize, formatSize(m.PayloadSize))
+	fmt.Printf("Chunks:   %d, in pieces of up to %s\n", len(m.Chunks), formatSize(int64(maxPiece)))
+	fmt.Printf("Manifest: %s\n", sopts.Manifest)
+	fmt.Println()
+	for _, c := range m.Chunks {
+		fmt.Printf("%5d %14d %10s %10s %s\n", c.Index, c.Offset, formatSize(c.Size), formatSize(int64(c.PieceSize)), c.PieceCID)
+	}
+	return exitOK
+}
+
+// splitter cuts the chunks of a split input
+type splitter struct {
+	in       io.Reader
+	maxPiece abi.PaddedPieceSize
+	// pad pads every piece to maxPiece
+	pad bool
+	// dir, if set, is where the chunks are written, named after base
+	dir, base string
+	opts      []fastcommp.Option
+}
+
+// minChunk is the smallest payload with a commP of its own; a last chunk
+// smaller than it is padded with zeros to the smallest piece, as the lotus
+// client does
+const minChunk = 65
+
+// next hashes the next chunk of the input, the index-th at offset, which
+// holds as much of the payload as a piece of maxPiece does, and writes it to
+// dir if set. It returns io.EOF at the end of the input.
+func (sp splitter) next(index int, offset int64) (splitChunk, error) {
+	// the head tells a last chunk too small for commP before hashing it
+	head := make([]byte, minChunk)
+	n, err := io.ReadFull(sp.in, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return splitChunk{}, err
+	}
+	if n == 0 {
+		return splitChunk{}, io.EOF
+	}
+	opts := sp.opts
+	switch {
+	case sp.pad:
+		opts = append(opts[:len(opts):len(opts)], fastcommp.WithTargetPieceSize(sp.maxPiece))
+	case n < minChunk:
+		opts = append(opts[:len(opts):len(opts)], fastcommp.WithTargetPieceSize(minPiece))
+	}
+
+	w, err := fastcommp.NewCommpWriter(opts...)
+	if err != nil {
+		return splitChunk{}, err
+	}
+	defer w.Close()
+	chunk := splitChunk{Index: index, Offset: offset}
+	var dst io.Writer = w
+	var out *atomicFile
+	if sp.dir != "" {
+		chunk.Path = filepath.Join(sp.dir, fmt.Sprintf("%s.%03d", sp.base, index))
+		if out, err = createAtomic(chunk.Path, 0644); err != nil {
+			return splitChunk{}, err
+		}
+		dst = io.MultiWriter(w, out)
+	}
+	fail := func(err error) (splitChunk, error) {
+		if out != nil {
+			out.abort()
+		}
+		return splitChunk{}, err
+	}
+
+	// the unpadded size of a piece is a whole number of Fr32 quanta, so
+	// every chunk but the last starts and ends on leaf boundaries
+	if _, err := dst.Write(head[:n]); err != nil {
+		return fail(err)
+	}
+	chunk.Size = int64(n)
+	if n == minChunk {
+		rest, err := io.CopyN(dst, sp.in, int64(sp.maxPiece.Unpadded())-minChunk)
+		if err != nil && err != io.EOF {
+			return fail(err)
+		}
+		chunk.Size += rest
+	}
+	sum, err := w.Sum()
+	if err != nil {
+		return fail(xerrors.Errorf("%d bytes: %w", chunk.Size, err))
+	}
+	if out != nil {
+		if err := out.commit(); err != nil {
+			return splitChunk{}, err
+		}
+	}
+	chunk.PieceCID, chunk.PieceSize = sum.PieceCID.String(), uint64(sum.PieceSize)
+	return chunk, nil
+}
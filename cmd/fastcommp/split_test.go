@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+)
+
+// referencePieceCID is the piece CID of data by go-fil-commp-hashhash, with
+// a payload too small for commP padded with zeros as the lotus client does
+func referencePieceCID(t *testing.T, data []byte) (string, uint64) {
+	t.Helper()
+	if len(data) < minChunk {
+		data = append(data[:len(data):len(data)], make([]byte, int(minPiece.Unpadded())-len(data))...)
+	}
+	cp := new(commp.Calc)
+	cp.Write(data)
+	raw, size, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := commcid.DataCommitmentV1ToCID(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.String(), size
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		size     int
+		maxPiece string
+	}{
+		{"one chunk", 1000, "1KiB"},
+		{"exact chunks", 2 * 1016, "1KiB"},
+		{"tiny remainder", 1026, "1KiB"},
+		{"one byte remainder", 3*1016 + 1, "1KiB"},
+		{"smallest remainder with commP", 1016 + minChunk, "1KiB"},
+		{"largest remainder without commP", 1016 + minChunk - 1, "1KiB"},
+		{"tiny input", 10, "1KiB"},
+		{"large chunks", 300000, "128KiB"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := make([]byte, tc.size)
+			rand.New(rand.NewSource(int64(tc.size))).Read(data)
+			input := filepath.Join(dir, "input")
+			if err := os.WriteFile(input, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			manifest := filepath.Join(dir, "manifest.json")
+			chunks := filepath.Join(dir, "chunks")
+			args := []string{"split", "--json", "--max-piece-size", tc.maxPiece, "--manifest", manifest, "--out-dir", chunks, input}
+			if status := runSplit(args); status != exitOK {
+				t.Fatalf("split exited with %d", status)
+			}
+
+			var m splitManifest
+			b, err := os.ReadFile(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			if m.PayloadSize != int64(tc.size) {
+				t.Errorf("payload size %d, expected %d", m.PayloadSize, tc.size)
+			}
+			var joined []byte
+			for i, c := range m.Chunks {
+				if c.Index != i || c.Offset != int64(len(joined)) {
+					t.Errorf("chunk %d is chunk %d at offset %d, expected offset %d", i, c.Index, c.Offset, len(joined))
+				}
+				want, wantSize := referencePieceCID(t, data[c.Offset:c.Offset+c.Size])
+				if c.PieceCID != want || c.PieceSize != wantSize {
+					t.Errorf("chunk %d of %d bytes: piece %s of %d bytes, expected %s of %d", i, c.Size, c.PieceCID, c.PieceSize, want, wantSize)
+				}
+				chunk, err := os.ReadFile(c.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				joined = append(joined, chunk...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Errorf("the %d chunks of %d bytes do not reassemble the input", len(m.Chunks), len(joined))
+			}
+		})
+	}
+}
+
+func TestSplitPad(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 1026)
+	rand.New(rand.NewSource(1)).Read(data)
+	input := filepath.Join(dir, "input")
+	if err := os.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := filepath.Join(dir, "manifest.json")
+	if status := runSplit([]string{"split", "--json", "--pad", "--max-piece-size", "1KiB", "--manifest", manifest, input}); status != exitOK {
+		t.Fatalf("split exited with %d", status)
+	}
+	var m splitManifest
+	b, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last chunk is the payload followed by zeros up to the whole piece
+	last := m.Chunks[len(m.Chunks)-1]
+	padded := append(append([]byte(nil), data[last.Offset:]...), make([]byte, 1016-last.Size)...)
+	want, _ := referencePieceCID(t, padded)
+	if last.PieceCID != want || last.PieceSize != 1024 {
+		t.Errorf("last chunk: piece %s of %d bytes, expected %s of 1024", last.PieceCID, last.PieceSize, want)
+	}
+}
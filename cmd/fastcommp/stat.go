@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// fileStat is the --stat metadata of a local input, recorded to tell later
+// whether it has changed
+type fileStat struct {
+	Size  int64
+	Mtime time.Time
+	Mode  string
+	// Inode and Device are zero where the filesystem has no such notion
+	Inode  uint64 `json:",omitempty"`
+	Device uint64 `json:",omitempty"`
+}
+
+func newFileStat(fi os.FileInfo) *fileStat {
+	st := &fileStat{
+		Size:  fi.Size(),
+		Mtime: fi.ModTime(),
+		Mode:  fi.Mode().String(),
+	}
+	st.Inode, st.Device = fileID(fi)
+	return st
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode number of the file described by fi and the
+// device it is on
+func fileID(fi os.FileInfo) (inode, device uint64) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Ino), uint64(st.Dev)
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"os"
+)
+
+// fileID returns zeros, as Windows file information carries no inode
+func fileID(fi os.FileInfo) (inode, device uint64) {
+	return 0, 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// checkpoint is the --state file of an interrupted run
+type checkpoint struct {
+	// Path, Offset and Length identify the payload, as given on the command
+	// line
+	Path   string
+	Offset int64
+	Length int64
+	// Written is the number of payload bytes covered by Writer
+	Written int64
+	// Writer is the CommpWriter state from MarshalState
+	Writer []byte
+}
+
+// loadState restores the progress on path saved in --state into w and
+// returns the number of payload bytes it covers, or 0 when there is no state
+// file yet
+func loadState(w *fastcommp.CommpWriter, path string) (int64, error) {
+	data, err := os.ReadFile(opts.State)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, xerrors.Errorf("reading state: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return 0, xerrors.Errorf("decoding state %s: %w", opts.State, err)
+	}
+	if cp.Path != path || cp.Offset != opts.Offset || cp.Length != opts.Length {
+		return 0, xerrors.Errorf("state %s was saved for another payload (%s at offset %d)", opts.State, cp.Path, cp.Offset)
+	}
+	if err := w.UnmarshalState(cp.Writer); err != nil {
+		return 0, xerrors.Errorf("restoring state %s: %w", opts.State, err)
+	}
+	return cp.Written, nil
+}
+
+// saveState writes the progress of w, which has been fed written bytes of
+// path, to --state. The file is replaced atomically, so an earlier
+// checkpoint survives a failure halfway. It holds payload data and is kept
+// private.
+func saveState(w *fastcommp.CommpWriter, path string, written int64) error {
+	st, err := w.MarshalState()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpoint{
+		Path:    path,
+		Offset:  opts.Offset,
+		Length:  opts.Length,
+		Written: written,
+		Writer:  st,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomic(opts.State, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.abort()
+		return err
+	}
+	return f.commit()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+)
+
+// dashboard is the --tui view of a run: the totals of the batch, a table of
+// the inputs in flight and the latest failures, redrawn on the alternate
+// screen of the terminal on stderr. What would be printed to the terminal
+// meanwhile is held back until it is closed.
+type dashboard struct {
+	mu  sync.Mutex
+	tty *os.File
+	// held is the output written to the terminal while the dashboard shows,
+	// until it is closed
+	held   []heldWrite
+	closed bool
+	once   sync.Once
+
+	batch   *batchProgress
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// heldWrite is output held back for w
+type heldWrite struct {
+	w io.Writer
+	p []byte
+}
+
+// dash is the --tui dashboard, nil without one
+var dash *dashboard
+
+// startDashboard switches the terminal on stderr to the --tui dashboard
+func startDashboard(inputs []string) error {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return xerrors.New("--tui needs a terminal on stderr")
+	}
+	batchStatus = newBatchProgress(inputs)
+	d := &dashboard{
+		tty:     os.Stderr,
+		batch:   batchStatus,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	dash = d
+	stdout, info, stderr = d.wrap(stdout), d.wrap(info), d.wrap(stderr)
+
+	// leave the alternate screen on the way out, unless --state turns
+	// SIGINT and SIGTERM into a checkpoint that ends the run normally
+	if opts.State == "" {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			stopDashboard()
+			os.Exit(130)
+		}()
+	}
+
+	fmt.Fprint(d.tty, "\033[?1049h\033[?25l")
+	go d.run()
+	return nil
+}
+
+// stopDashboard restores the terminal and prints the output held back. It
+// may be called by the signal handler and the main goroutine alike.
+func stopDashboard() {
+	if dash == nil {
+		return
+	}
+	dash.once.Do(dash.close)
+}
+
+func (d *dashboard) close() {
+	close(d.stop)
+	<-d.stopped
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprint(d.tty, "\033[?25h\033[?1049l")
+	for _, h := range d.held {
+		h.w.Write(h.p)
+	}
+	d.held, d.closed = nil, true
+}
+
+func (d *dashboard) run() {
+	defer close(d.stopped)
+	t := time.NewTicker(barInterval)
+	defer t.Stop()
+	for {
+		d.redraw()
+		select {
+		case <-t.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// redraw draws the dashboard over the whole screen
+func (d *dashboard) redraw() {
+	width, height, err := term.GetSize(int(d.tty.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	type row struct {
+		path    string
+		n, size int64
+		elapsed time.Duration
+	}
+	var rows []row
+	var hashed int64
+	running.Lock()
+	for _, j := range running.jobs {
+		n := j.progress()
+		hashed += n
+		rows = append(rows, row{j.path, n, j.size, time.Since(j.start)})
+	}
+	running.Unlock()
+	s := d.batch.snapshot()
+	elapsed := time.Since(s.start)
+
+	lines := []string{
+		fmt.Sprintf("fastcommp  %d/%d files done  %d failed  %d in flight  %s elapsed",
+			s.finished, s.files, s.failed, len(rows), elapsed.Round(time.Second)),
+		barLine("total", s.done+hashed, s.total, elapsed, width),
+		"",
+		"In flight:",
+	}
+	// the failures get the bottom of the screen, the inputs in flight the
+	// rest of it
+	room := height - len(lines) - 2
+	if len(s.errors) > 0 {
+		room -= len(s.errors) + 2
+	}
+	for i, r := range rows {
+		if i == room-1 && len(rows) > room {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(rows)-i))
+			break
+		}
+		if i >= room {
+			break
+		}
+		lines = append(lines, "  "+barLine(r.path, r.n, r.size, r.elapsed, width-2))
+	}
+	if len(s.errors) > 0 {
+		lines = append(lines, "", "Latest failures:")
+		for _, e := range s.errors {
+			if len(e) > width-2 {
+				e = e[:width-2]
+			}
+			lines = append(lines, "  "+e)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprint(d.tty, "\033[H"+strings.Join(lines, "\033[K\r\n")+"\033[K\033[J")
+}
+
+// wrap returns w, or if w is a terminal a writer that holds its output back
+// until the dashboard is closed
+func (d *dashboard) wrap(w io.Writer) io.Writer {
+	if f, ok := w.(*os.File); !ok || !term.IsTerminal(int(f.Fd())) {
+		return w
+	}
+	return heldWriter{d, w}
+}
+
+// heldWriter writes to a terminal that shows the dashboard
+type heldWriter struct {
+	d *dashboard
+	w io.Writer
+}
+
+func (w heldWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	if w.d.closed {
+		return w.w.Write(p)
+	}
+	w.d.held = append(w.d.held, heldWrite{w.w, append([]byte(nil), p...)})
+	return len(p), nil
+}
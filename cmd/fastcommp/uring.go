@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// hashURing hashes the local file f of size bytes with reads submitted
+// through io_uring, one leaf-sized read in flight per hashing worker that is
+// waiting for data. ok is false, and the file is to be read as usual, if no
+// ring can be set up.
+func hashURing(ctx context.Context, res result, f *os.File, size int64, writerOpts []fastcommp.Option) (result, bool, error) {
+	off, n, err := inputRange(size)
+	if err != nil {
+		return res, true, xerrors.Errorf("opening input: %w", err)
+	}
+	ring, err := newURingFile(f)
+	if err != nil {
+		return res, false, nil
+	}
+	defer ring.Close()
+
+	start := time.Now()
+	sum, err := fastcommp.SumReaderAtContext(ctx, io.NewSectionReader(ring, off, n), n, writerOpts...)
+	if err != nil {
+		return res, true, xerrors.Errorf("calculating commP: %w", err)
+	}
+	res.DataCIDSize = sum
+	res.elapsed = time.Since(start)
+	res.read, res.readBytes = res.elapsed, n
+	return res, true, nil
+}
@@ -0,0 +1,265 @@
+//go:build linux && iouring
+
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/xerrors"
+)
+
+// uringBuilt reports whether io_uring support is compiled in
+const uringBuilt = true
+
+// uringEntries is the submission queue depth of a ring
+const uringEntries = 64
+
+// uringStop is the user data of the nop that stops the reaper of a ring
+const uringStop = ^uint64(0)
+
+// io_uring ABI, from linux/io_uring.h
+const (
+	ioringOffSQRing = 0
+	ioringOffCQRing = 0x8000000
+	ioringOffSQEs   = 0x10000000
+
+	ioringOpNop  = 0
+	ioringOpRead = 22
+
+	ioringEnterGetEvents = 1
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uringFile reads a file through an io_uring. ReadAt may be called from
+// several goroutines at once; each call submits its read and waits for its
+// completion, which a reaper goroutine hands back.
+type uringFile struct {
+	f    *os.File
+	fd   int
+	sq   []byte
+	cq   []byte
+	sqes []byte
+
+	sqHead, sqTail, sqMask, sqArray *uint32
+	cqHead, cqTail, cqMask          *uint32
+	cqes                            unsafe.Pointer
+
+	mu      sync.Mutex
+	nextID  uint64
+	waiting map[uint64]chan int32
+	reaped  chan struct{}
+}
+
+// newURingFile sets up a ring for reading f
+func newURingFile(f *os.File) (*uringFile, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uringEntries, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, xerrors.Errorf("io_uring_setup: %w", errno)
+	}
+	r := &uringFile{f: f, fd: int(fd), waiting: make(map[uint64]chan int32), reaped: make(chan struct{})}
+
+	var err error
+	if r.sq, err = unix.Mmap(r.fd, ioringOffSQRing, int(p.sqOff.array+p.sqEntries*4), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.unmap()
+		return nil, xerrors.Errorf("mapping io_uring submission queue: %w", err)
+	}
+	if r.cq, err = unix.Mmap(r.fd, ioringOffCQRing, int(p.cqOff.cqes+p.cqEntries*uint32(unsafe.Sizeof(uringCQE{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.unmap()
+		return nil, xerrors.Errorf("mapping io_uring completion queue: %w", err)
+	}
+	if r.sqes, err = unix.Mmap(r.fd, ioringOffSQEs, int(p.sqEntries*uint32(unsafe.Sizeof(uringSQE{}))), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		r.unmap()
+		return nil, xerrors.Errorf("mapping io_uring submission entries: %w", err)
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sq[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sq[p.sqOff.tail]))
+	r.sqMask = (*uint32)(unsafe.Pointer(&r.sq[p.sqOff.ringMask]))
+	r.sqArray = (*uint32)(unsafe.Pointer(&r.sq[p.sqOff.array]))
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cq[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cq[p.cqOff.tail]))
+	r.cqMask = (*uint32)(unsafe.Pointer(&r.cq[p.cqOff.ringMask]))
+	r.cqes = unsafe.Pointer(&r.cq[p.cqOff.cqes])
+
+	go r.reap()
+	return r, nil
+}
+
+// ReadAt fills p from the file at off, resubmitting short reads
+func (r *uringFile) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		res, err := r.read(p[n:], off+int64(n))
+		if err != nil {
+			return n, err
+		}
+		if res == 0 {
+			return n, io.EOF
+		}
+		n += res
+	}
+	return n, nil
+}
+
+// read submits a single read into p and waits for its result
+func (r *uringFile) read(p []byte, off int64) (int, error) {
+	done := make(chan int32, 1)
+	sqe := uringSQE{
+		opcode: ioringOpRead,
+		fd:     int32(r.f.Fd()),
+		off:    uint64(off),
+		addr:   uint64(uintptr(unsafe.Pointer(&p[0]))),
+		len:    uint32(len(p)),
+	}
+	if err := r.submit(sqe, done); err != nil {
+		return 0, err
+	}
+	res := <-done
+	if res < 0 {
+		return 0, &os.PathError{Op: "read", Path: r.f.Name(), Err: syscall.Errno(-res)}
+	}
+	return int(res), nil
+}
+
+// submit queues sqe, numbered unless it is the uringStop nop, and tells the
+// kernel about it. Its result is sent on done. A full queue has the caller
+// wait until the reaper has made room.
+func (r *uringFile) submit(sqe uringSQE, done chan int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for atomic.LoadUint32(r.sqTail)-atomic.LoadUint32(r.sqHead) >= uringEntries {
+		r.mu.Unlock()
+		<-r.reaped
+		r.mu.Lock()
+	}
+
+	if sqe.userData != uringStop {
+		r.nextID++
+		sqe.userData = r.nextID
+	}
+	r.waiting[sqe.userData] = done
+
+	tail := atomic.LoadUint32(r.sqTail)
+	idx := tail & atomic.LoadUint32(r.sqMask)
+	*(*uringSQE)(unsafe.Pointer(&r.sqes[uintptr(idx)*unsafe.Sizeof(uringSQE{})])) = sqe
+	*(*uint32)(unsafe.Add(unsafe.Pointer(r.sqArray), uintptr(idx)*4)) = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+
+	if _, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), 1, 0, 0, 0, 0); errno != 0 {
+		delete(r.waiting, sqe.userData)
+		return xerrors.Errorf("io_uring_enter: %w", errno)
+	}
+	return nil
+}
+
+// reap waits for completions and hands each result to its submitter. It
+// returns on the completion of the nop submitted by Close.
+func (r *uringFile) reap() {
+	for {
+		if _, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), 0, 1, ioringEnterGetEvents, 0, 0); errno != 0 && errno != unix.EINTR {
+			r.failAll(-int32(errno))
+			return
+		}
+
+		head, tail := atomic.LoadUint32(r.cqHead), atomic.LoadUint32(r.cqTail)
+		for ; head != tail; head++ {
+			idx := head & atomic.LoadUint32(r.cqMask)
+			cqe := (*uringCQE)(unsafe.Add(r.cqes, uintptr(idx)*unsafe.Sizeof(uringCQE{})))
+
+			r.mu.Lock()
+			done := r.waiting[cqe.userData]
+			delete(r.waiting, cqe.userData)
+			r.mu.Unlock()
+			if done == nil {
+				continue
+			}
+			done <- cqe.res
+			if cqe.userData == uringStop {
+				atomic.StoreUint32(r.cqHead, head+1)
+				return
+			}
+		}
+		atomic.StoreUint32(r.cqHead, head)
+
+		// wake submitters waiting for room in the queue
+		select {
+		case r.reaped <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// failAll fails every outstanding operation with res
+func (r *uringFile) failAll(res int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, done := range r.waiting {
+		done <- res
+		delete(r.waiting, id)
+	}
+}
+
+// Close stops the reaper and tears down the ring. The file stays open.
+func (r *uringFile) Close() error {
+	done := make(chan int32, 1)
+	if err := r.submit(uringSQE{opcode: ioringOpNop, userData: uringStop}, done); err == nil {
+		<-done
+	}
+	r.unmap()
+	return unix.Close(r.fd)
+}
+
+func (r *uringFile) unmap() {
+	for _, m := range [][]byte{r.sq, r.cq, r.sqes} {
+		if m != nil {
+			unix.Munmap(m)
+		}
+	}
+}
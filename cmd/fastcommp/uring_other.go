@@ -0,0 +1,21 @@
+//go:build !linux || !iouring
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// uringBuilt reports whether io_uring support is compiled in, which takes
+// Linux and the iouring build tag
+const uringBuilt = false
+
+func newURingFile(f *os.File) (interface {
+	io.ReaderAt
+	io.Closer
+}, error) {
+	return nil, xerrors.New("built without io_uring support")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+	"golang.org/x/xerrors"
+
+	"github.com/application-research/fastcommp"
+)
+
+// runVerifyInclusion checks offline that the --piece is in the --aggregate
+// deal, with the inclusion proof an aggregator wrote with --proof-dir
+func runVerifyInclusion(args []string) int {
+	var vopts struct {
+		Help      bool   `getopt:"--help -h display this help"`
+		Aggregate string `getopt:"--aggregate=CID the piece CID of the aggregate deal"`
+		Piece     string `getopt:"--piece=CID the piece CID of the piece in it"`
+		Proof     string `getopt:"--proof=FILE the inclusion proof of the piece, as written by aggregate --proof-dir"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp verify-inclusion")
+	set.SetParameters("")
+	options.RegisterSet("verify-inclusion", &vopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if vopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 0 || vopts.Aggregate == "" || vopts.Piece == "" || vopts.Proof == "" {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+
+	data, err := os.ReadFile(vopts.Proof)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitIO
+	}
+	var file inclusionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading --proof %s: %s\n", vopts.Proof, err)
+		return exitFailed
+	}
+	aggregate, err := pieceInfo(vopts.Aggregate, file.AggregateSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --aggregate: %s\n", err)
+		return exitUsage
+	}
+	piece, err := pieceInfo(vopts.Piece, file.PieceSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --piece: %s\n", err)
+		return exitUsage
+	}
+
+	if err := fastcommp.VerifyInclusion(aggregate, piece, file.Proof); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return exitFailed
+	}
+	offset := abi.PaddedPieceSize(file.Proof.Subtree.Index) * piece.Size
+	fmt.Printf("Verified: %s is in %s at offset %d (%d unpadded), with its data segment index entry\n", vopts.Piece, vopts.Aggregate, offset, offset.Unpadded())
+	return exitOK
+}
+
+// pieceInfo returns the piece of the piece CID s, v1 or v2, whose size is
+// that a v2 CID encodes or else size, from the proof
+func pieceInfo(s string, size abi.PaddedPieceSize) (abi.PieceInfo, error) {
+	c, err := cid.Decode(s)
+	if err != nil {
+		return abi.PieceInfo{}, xerrors.Errorf("decoding CID %s: %w", s, err)
+	}
+	dm, err := multihash.Decode(c.Hash())
+	if err != nil {
+		return abi.PieceInfo{}, xerrors.Errorf("decoding the multihash of %s: %w", s, err)
+	}
+	if dm.Code != fr32Sha256Trunc254Padbintree {
+		if size == 0 {
+			return abi.PieceInfo{}, xerrors.Errorf("the proof has no size for the piece CID v1 %s", s)
+		}
+		return abi.PieceInfo{Size: size, PieceCID: c}, nil
+	}
+
+	_, height, commP, err := splitPieceDigest(dm.Digest)
+	if err != nil {
+		return abi.PieceInfo{}, xerrors.Errorf("%s: %w", s, err)
+	}
+	if height < 2 || height > 57 {
+		return abi.PieceInfo{}, xerrors.Errorf("%s has the invalid tree height %d", s, height)
+	}
+	v2Size := abi.PaddedPieceSize(32) << height
+	if size != 0 && size != v2Size {
+		return abi.PieceInfo{}, xerrors.Errorf("%s is a piece of %d bytes, but the proof is of one of %d", s, v2Size, size)
+	}
+	v1, err := commcid.PieceCommitmentV1ToCID(commP)
+	if err != nil {
+		return abi.PieceInfo{}, err
+	}
+	return abi.PieceInfo{Size: v2Size, PieceCID: v1}, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"github.com/application-research/fastcommp"
+)
+
+// fip69PieceCID returns the piece CID v2 of a payload of payloadSize bytes in
+// the piece of sum, as FIP-0069 lays it out: the padding and tree height
+// before the commitment, in a raw CID
+func fip69PieceCID(t *testing.T, sum fastcommp.DataCIDSize) string {
+	t.Helper()
+	commP, err := commcid.CIDToPieceCommitmentV1(sum.PieceCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := binary.AppendUvarint(nil, uint64(sum.PieceSize.Unpadded())-uint64(sum.PayloadSize))
+	digest = append(digest, byte(bits.TrailingZeros64(uint64(sum.PieceSize/32))))
+	digest = append(digest, commP...)
+	mh, err := multihash.Encode(digest, fr32Sha256Trunc254Padbintree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, mh).String()
+}
+
+func TestVerifyInclusionCommand(t *testing.T) {
+	dir := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	var sums []fastcommp.DataCIDSize
+	var entries []pieceEntry
+	for _, size := range []int{3000, 500, 70000, 1000} {
+		data := make([]byte, size)
+		rng.Read(data)
+		sum, err := fastcommp.SumBytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums = append(sums, sum)
+		entries = append(entries, pieceEntry{PieceCID: sum.PieceCID.String(), PieceSize: uint64(sum.PieceSize)})
+	}
+	list, _ := json.Marshal(entries)
+	piecesFile := filepath.Join(dir, "pieces.json")
+	if err := os.WriteFile(piecesFile, list, 0644); err != nil {
+		t.Fatal(err)
+	}
+	proofDir := filepath.Join(dir, "proofs")
+	if status := runAggregate([]string{"aggregate", "--json", "--data-segment-index", "--proof-dir", proofDir, piecesFile}); status != exitOK {
+		t.Fatalf("aggregate exited with %d", status)
+	}
+
+	proofOf := func(sum fastcommp.DataCIDSize) string {
+		return filepath.Join(proofDir, sum.PieceCID.String()+".json")
+	}
+	var file inclusionFile
+	b, err := os.ReadFile(proofOf(sums[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		t.Fatal(err)
+	}
+	aggregate := file.AggregateCID
+
+	for _, tc := range []struct {
+		name         string
+		piece, proof string
+		aggregate    string
+		status       int
+	}{
+		{"piece CID v1", sums[0].PieceCID.String(), proofOf(sums[0]), aggregate, exitOK},
+		{"last piece", sums[3].PieceCID.String(), proofOf(sums[3]), aggregate, exitOK},
+		{"piece CID v2", fip69PieceCID(t, sums[2]), proofOf(sums[2]), aggregate, exitOK},
+		{"proof of another piece", sums[1].PieceCID.String(), proofOf(sums[2]), aggregate, exitFailed},
+		{"another aggregate", sums[1].PieceCID.String(), proofOf(sums[1]), sums[0].PieceCID.String(), exitFailed},
+		{"invalid piece CID", "nope", proofOf(sums[1]), aggregate, exitUsage},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status := runVerifyInclusion([]string{"verify-inclusion", "--aggregate", tc.aggregate, "--piece", tc.piece, "--proof", tc.proof})
+			if status != tc.status {
+				t.Errorf("verify-inclusion exited with %d, expected %d", status, tc.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+)
+
+func getxattr(name, attr string) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func setxattr(name, attr string, value []byte) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// getxattr returns the value of the extended attribute attr of the file
+// called name
+func getxattr(name, attr string) ([]byte, error) {
+	for {
+		sz, err := unix.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		buf := make([]byte, sz)
+		n, err := unix.Getxattr(name, attr, buf)
+		// the value may have grown since it was measured
+		if err == unix.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, xattrError(err)
+		}
+		return buf[:n], nil
+	}
+}
+
+// setxattr sets the extended attribute attr of the file called name
+func setxattr(name, attr string, value []byte) error {
+	return xattrError(unix.Setxattr(name, attr, value, 0))
+}
+
+// xattrError reports the lack of extended attributes in the filesystem as
+// errors.ErrUnsupported
+func xattrError(err error) error {
+	if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+		return errors.ErrUnsupported
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/pborman/getopt/v2"
+	"github.com/pborman/options"
+
+	"github.com/application-research/fastcommp"
+)
+
+// runZero prints the piece CID of a zero piece of --size, for padding deal
+// aggregates, or of a --payload of zeros, without hashing the zeros
+func runZero(args []string) int {
+	var zopts struct {
+		Help    bool     `getopt:"--help -h display this help"`
+		Size    byteSize `getopt:"--size=SIZE the padded size of the zero piece, a power of two such as 2KiB or 16GiB"`
+		Payload byteSize `getopt:"--payload=SIZE the size of a payload of zeros, such as 1000000 or 30GiB, instead"`
+	}
+	set := getopt.New()
+	set.SetProgram("fastcommp zero")
+	set.SetParameters("")
+	options.RegisterSet("zero", &zopts, set)
+	args, err := parseArgs(set, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+	if zopts.Help {
+		set.PrintUsage(os.Stderr)
+		return exitOK
+	}
+	if len(args) != 0 || (zopts.Size == 0) == (zopts.Payload == 0) {
+		set.PrintUsage(os.Stderr)
+		return exitUsage
+	}
+
+	if zopts.Payload != 0 {
+		sum, err := fastcommp.SumZeros(int64(zopts.Payload))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --payload %d: %s\n", zopts.Payload, err)
+			return exitUsage
+		}
+		fmt.Println(sum.PieceCID)
+		return exitOK
+	}
+	c, err := fastcommp.ZeroPieceCID(abi.PaddedPieceSize(zopts.Size))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --size %d: %s; `fastcommp size` gives the piece of a payload\n", zopts.Size, err)
+		return exitUsage
+	}
+	fmt.Println(c)
+	return exitOK
+}
@@ -0,0 +1,130 @@
+package fastcommp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	sha256simd "github.com/minio/sha256-simd"
+	"golang.org/x/xerrors"
+)
+
+// SegmentEntrySize is the padded size of an entry of the FRC-0058 data
+// segment index, two nodes of the piece tree
+const SegmentEntrySize = 64
+
+// SegmentEntry is an entry of the FRC-0058 data segment index of a deal,
+// describing a piece aggregated into it
+type SegmentEntry struct {
+	// CommDs is the piece CID of the data segment
+	CommDs cid.Cid
+	// Offset and Size are the padded offset and size of the segment in
+	// the deal
+	Offset uint64
+	Size   uint64
+	// Checksum is the sha256 of the serialized entry with a zero checksum,
+	// truncated to 126 bits
+	Checksum [16]byte
+}
+
+// MaxSegmentEntries returns the number of entries of the data segment index
+// of a deal of dealSize, which are 1/2048 of the deal rounded up to a power
+// of two, and at least 4
+func MaxSegmentEntries(dealSize abi.PaddedPieceSize) int {
+	n := uint64(dealSize) / 2048 / SegmentEntrySize
+	if n <= 4 {
+		return 4
+	}
+	return 1 << bits.Len64(n-1)
+}
+
+// SegmentIndexOffset returns the padded offset of the data segment index of
+// a deal of dealSize, which fills the end of the deal
+func SegmentIndexOffset(dealSize abi.PaddedPieceSize) abi.PaddedPieceSize {
+	return dealSize - abi.PaddedPieceSize(MaxSegmentEntries(dealSize)*SegmentEntrySize)
+}
+
+// newSegmentEntry returns the index entry of the piece with commitment
+// commP at offset. Like computeChecksum of go-data-segment, the checksum
+// hashes all 64 bytes of the entry, with the checksum still zero.
+func newSegmentEntry(p PlacedPiece, commP commitment) SegmentEntry {
+	e := SegmentEntry{CommDs: p.PieceCID, Offset: uint64(p.Offset), Size: uint64(p.Size)}
+	node := e.nodes(commP)
+	sum := sha256.Sum256(node[:])
+	copy(e.Checksum[:], sum[:])
+	e.Checksum[len(e.Checksum)-1] &= 0b00111111
+	return e
+}
+
+// nodes returns the entry as the two nodes of the piece tree it takes: the
+// commitment, then the little-endian offset and size and the checksum
+func (e SegmentEntry) nodes(commP commitment) [SegmentEntrySize]byte {
+	var b [SegmentEntrySize]byte
+	copy(b[:32], commP[:])
+	binary.LittleEndian.PutUint64(b[32:40], e.Offset)
+	binary.LittleEndian.PutUint64(b[40:48], e.Size)
+	copy(b[48:], e.Checksum[:])
+	return b
+}
+
+// segmentIndex returns the padded data segment index of entries, the nodes
+// of the index area of a deal of dealSize
+func segmentIndex(dealSize abi.PaddedPieceSize, entries []SegmentEntry) ([]byte, error) {
+	index := make([]byte, MaxSegmentEntries(dealSize)*SegmentEntrySize)
+	for i, e := range entries {
+		commP, err := cidCommitment(e.CommDs)
+		if err != nil {
+			return nil, xerrors.Errorf("index entry %d: %w", i, err)
+		}
+		node := e.nodes(commP)
+		copy(index[i*SegmentEntrySize:], node[:])
+	}
+	return index, nil
+}
+
+// SegmentIndex returns the data segment index of the aggregate as it is
+// written to the deal payload, at the unpadded IndexOffset: the unpadded
+// form of its nodes, from which Fr32 padding restores them
+func (a Aggregate) SegmentIndex() ([]byte, error) {
+	if a.Index == nil {
+		return nil, xerrors.New("the aggregate has no data segment index")
+	}
+	index, err := segmentIndex(a.PieceSize, a.Index)
+	if err != nil {
+		return nil, err
+	}
+	return fr32Unpad(index), nil
+}
+
+// fr32Unpad returns the unpadded form of the padded data, a multiple of 128
+// bytes: each 32-byte node holds 254 bits of the unpadded bit stream, least
+// significant bit first
+func fr32Unpad(padded []byte) []byte {
+	out := make([]byte, len(padded)/128*127)
+	for i := 0; i < len(out)*8; i++ {
+		src := i/254*256 + i%254
+		if padded[src/8]&(1<<(src%8)) != 0 {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+// treeRoot returns the root of the tree whose nodes are the 32-byte nodes,
+// a power of two of them
+func treeRoot(nodes []byte) commitment {
+	level := make([]commitment, len(nodes)/32)
+	for i := range level {
+		copy(level[i][:], nodes[i*32:])
+	}
+	h := sha256simd.New()
+	for len(level) > 1 {
+		for i := range level[:len(level)/2] {
+			level[i] = hashNode(h, level[2*i], level[2*i+1])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0]
+}
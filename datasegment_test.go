@@ -0,0 +1,180 @@
+package fastcommp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// refEntry serializes the index entry of a piece as SerializeFr32 of
+// go-data-segment does, with the checksum of its computeChecksum: the sha256
+// of the entry with a zero checksum, truncated to 16 bytes and 126 bits
+func refEntry(commP []byte, offset, size uint64) []byte {
+	b := make([]byte, 64)
+	copy(b, commP)
+	binary.LittleEndian.PutUint64(b[32:], offset)
+	binary.LittleEndian.PutUint64(b[40:], size)
+	sum := sha256.Sum256(b)
+	copy(b[48:], sum[:16])
+	b[63] &= 0x3f
+	return b
+}
+
+// refRoot returns the root of the piece tree over nodes, with the standard
+// library sha256 truncated to 254 bits
+func refRoot(nodes []byte) []byte {
+	level := nodes
+	for len(level) > 32 {
+		up := make([]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 64 {
+			h := sha256.Sum256(level[i : i+64])
+			h[31] &= 0x3f
+			up = append(up, h[:]...)
+		}
+		level = up
+	}
+	return level
+}
+
+// testPieces returns n pieces of random payloads of up to max bytes, and the
+// payloads
+func testPieces(t testing.TB, rng *rand.Rand, n, max int) ([]abi.PieceInfo, [][]byte) {
+	t.Helper()
+	pieces := make([]abi.PieceInfo, n)
+	payloads := make([][]byte, n)
+	for i := range pieces {
+		payloads[i] = make([]byte, 65+rng.Intn(max-65))
+		rng.Read(payloads[i])
+		sum, err := SumBytes(payloads[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		pieces[i] = abi.PieceInfo{Size: sum.PieceSize, PieceCID: sum.PieceCID}
+	}
+	return pieces, payloads
+}
+
+// refCommP returns the commP of payload by go-fil-commp-hashhash
+func refCommP(t testing.TB, payload []byte) ([]byte, uint64) {
+	t.Helper()
+	cp := new(commp.Calc)
+	cp.Write(payload)
+	raw, size, err := cp.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw, size
+}
+
+func TestSegmentEntry(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		offset, size uint64
+	}{
+		{0, 128},
+		{128, 128},
+		{1 << 20, 1 << 20},
+		{31 << 30, 1 << 30},
+		{1<<40 - 1<<35, 1 << 35},
+	} {
+		var commP commitment
+		rng.Read(commP[:])
+		commP[31] &= 0x3f
+		c, err := commcid.DataCommitmentV1ToCID(commP[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := newSegmentEntry(PlacedPiece{PieceCID: c, Size: abi.PaddedPieceSize(tc.size), Offset: abi.PaddedPieceSize(tc.offset)}, commP)
+		got := e.nodes(commP)
+		want := refEntry(commP[:], tc.offset, tc.size)
+		if !bytes.Equal(got[:], want) {
+			t.Errorf("entry of %d bytes at %d:\n got %x\nwant %x", tc.size, tc.offset, got, want)
+		}
+		if got[63]&0xc0 != 0 {
+			t.Errorf("entry of %d bytes at %d: the checksum node is not a field element", tc.size, tc.offset)
+		}
+	}
+}
+
+func TestMaxSegmentEntries(t *testing.T) {
+	for _, tc := range []struct {
+		dealSize abi.PaddedPieceSize
+		entries  int
+	}{
+		{128, 4},
+		{2 << 10, 4},
+		{512 << 10, 4},
+		{1 << 20, 8},
+		{32 << 20, 256},
+		{32 << 30, 256 << 10},
+		{64 << 30, 512 << 10},
+	} {
+		if got := MaxSegmentEntries(tc.dealSize); got != tc.entries {
+			t.Errorf("MaxSegmentEntries(%d) = %d, expected %d", tc.dealSize, got, tc.entries)
+		}
+	}
+}
+
+func TestAggregateDealIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, tc := range []struct {
+		dealSize abi.PaddedPieceSize
+		pieces   int
+		max      int
+	}{
+		{0, 1, 1000},
+		{0, 3, 10000},
+		{64 << 10, 4, 2000},
+		{1 << 20, 7, 100000},
+		{8 << 20, 40, 100000},
+	} {
+		pieces, payloads := testPieces(t, rng, tc.pieces, tc.max)
+		agg, err := AggregateDeal(tc.dealSize, pieces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(agg.Index) != len(pieces) || agg.IndexOffset != SegmentIndexOffset(agg.PieceSize) {
+			t.Fatalf("deal of %d bytes: %d index entries at %d", agg.PieceSize, len(agg.Index), agg.IndexOffset)
+		}
+
+		// the index as go-data-segment serializes it
+		want := make([]byte, MaxSegmentEntries(agg.PieceSize)*SegmentEntrySize)
+		for i, p := range agg.Pieces {
+			commP, err := commcid.CIDToPieceCommitmentV1(p.PieceCID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(want[i*SegmentEntrySize:], refEntry(commP, uint64(p.Offset), uint64(p.Size)))
+		}
+		index, err := agg.SegmentIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(index) != len(want)/128*127 {
+			t.Fatalf("deal of %d bytes: index of %d bytes, expected %d", agg.PieceSize, len(index), len(want)/128*127)
+		}
+		root, _ := refCommP(t, index)
+		if !bytes.Equal(root, refRoot(want)) {
+			t.Errorf("deal of %d bytes: the index is not the serialized entries", agg.PieceSize)
+		}
+
+		// the payload of the deal, with the pieces and index at their
+		// unpadded offsets, has the piece CID of the aggregate
+		deal := make([]byte, agg.PieceSize.Unpadded())
+		for i, p := range agg.Pieces {
+			copy(deal[p.Offset.Unpadded():], payloads[i])
+		}
+		copy(deal[agg.IndexOffset.Unpadded():], index)
+		commP, size := refCommP(t, deal)
+		c, _ := commcid.DataCommitmentV1ToCID(commP)
+		if !c.Equals(agg.PieceCID) || size != uint64(agg.PieceSize) {
+			t.Errorf("deal of %d bytes is %s, but its payload is %s of %d bytes", agg.PieceSize, agg.PieceCID, c, size)
+		}
+	}
+}
@@ -1,19 +1,27 @@
+// Package fastcommp calculates Filecoin piece commitments (commP) of large
+// payloads by hashing fixed-size leaves of the payload in parallel and folding
+// the leaf commitments into the final piece CID.
+//
+// The typical use is to stream a payload into a CommpWriter and call Sum once
+// all of the data has been written:
+//
+//	w := new(fastcommp.CommpWriter)
+//	if _, err := io.Copy(w, f); err != nil {
+//		return err
+//	}
+//	sum, err := w.Sum()
 package fastcommp
 
 import (
+	"encoding/binary"
 	"math/bits"
-	"runtime"
-
-	"github.com/filecoin-project/go-commp-utils/nonffi"
-	commcid "github.com/filecoin-project/go-fil-commcid"
-	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
 	"golang.org/x/xerrors"
 
 	"github.com/filecoin-project/go-state-types/abi"
-
-	"github.com/filecoin-project/go-commp-utils/zerocomm"
 )
 
 // DataCIDSize is the result of a DataCID calculation
@@ -21,154 +29,133 @@ type DataCIDSize struct {
 	PayloadSize int64
 	PieceSize   abi.PaddedPieceSize
 	PieceCID    cid.Cid
-}
 
-// commPBufPad is the size of the buffer used to calculate commP
-const commPBufPad = abi.PaddedPieceSize(8 << 20)
-
-// CommPBuf is the size of the buffer used to calculate commP
-const CommPBuf = abi.UnpaddedPieceSize(commPBufPad - (commPBufPad / 128))
+	// PieceCommitment is the raw 32-byte commitment wrapped by PieceCID
+	PieceCommitment []byte
+	// Multihash is the multihash of PieceCID
+	Multihash multihash.Multihash
+
+	// UnpaddedPieceSize is PieceSize before Fr32 padding
+	UnpaddedPieceSize abi.UnpaddedPieceSize
+	// PaddingSize is the number of zero bytes appended to the payload to
+	// fill UnpaddedPieceSize
+	PaddingSize int64
+	// LeafCount is the number of leaves holding payload, not counting the
+	// zero leaves added to reach a power-of-two piece
+	LeafCount int
+	// TreeHeight is the number of layers between the 32-byte nodes and the
+	// root of the piece tree, log2(PieceSize / 32)
+	TreeHeight int
+	// SectorSize is the smallest sector the piece fits in, which is the
+	// piece itself when it was padded by WithSealProof, or 0 when the piece
+	// is larger than any sector
+	SectorSize abi.SectorSize
+
+	// Timings tells where the time of the calculation went
+	Timings Timings `json:"-"`
+}
 
-// ciderr is a cid and an error
-type ciderr struct {
-	c   cid.Cid
-	err error
+// Timings break down the time taken by a commP calculation
+type Timings struct {
+	// Hash is the time spent hashing full leaves, added up over all hashing
+	// goroutines
+	Hash time.Duration
+	// Tree is the time Sum spent folding the leaf commitments, and hashing the
+	// payload tail, into the piece commitment. A streaming writer folds most
+	// leaves while they are written, which is not included.
+	Tree time.Duration
 }
 
-// CommpWriter is a writer that calculates the CommP
-type CommpWriter struct {
-	len    int64
-	buf    [CommPBuf]byte
-	leaves []chan ciderr
+// newDataCIDSize fills in a DataCIDSize for the piece with commitment commP
+// built from leafCount leaves of payload
+func newDataCIDSize(payloadSize int64, pieceSize abi.PaddedPieceSize, leafCount int, commP commitment) (DataCIDSize, error) {
+	p, err := commP.pieceCID()
+	if err != nil {
+		return DataCIDSize{}, xerrors.Errorf("converting piece commitment: %w", err)
+	}
 
-	tbufs    [][CommPBuf]byte
-	throttle chan int
+	return DataCIDSize{
+		PayloadSize:     payloadSize,
+		PieceSize:       pieceSize,
+		PieceCID:        p,
+		PieceCommitment: commP[:],
+		Multihash:       p.Hash(),
+
+		UnpaddedPieceSize: pieceSize.Unpadded(),
+		PaddingSize:       int64(pieceSize.Unpadded()) - payloadSize,
+		LeafCount:         leafCount,
+		TreeHeight:        bits.TrailingZeros64(uint64(pieceSize)) - 5,
+		SectorSize:        smallestSector(pieceSize),
+	}, nil
 }
 
-// Write writes data to the DataCidWriter
-func (w *CommpWriter) Write(p []byte) (int, error) {
-	if w.throttle == nil {
-		w.throttle = make(chan int, runtime.NumCPU())
+// NewDataCIDSize returns the DataCIDSize of a payload of payloadSize bytes
+// whose piece of pieceSize has the v1 pieceCID, such as a result stored by
+// an earlier calculation with the same opts
+func NewDataCIDSize(pieceCID cid.Cid, payloadSize int64, pieceSize abi.PaddedPieceSize, opts ...Option) (DataCIDSize, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return DataCIDSize{}, err
 	}
-	for i := 0; i < cap(w.throttle); i++ {
-		w.throttle <- i
+	if err := pieceSize.Validate(); err != nil {
+		return DataCIDSize{}, xerrors.Errorf("invalid piece size: %w", err)
 	}
-	if w.tbufs == nil {
-		w.tbufs = make([][CommPBuf]byte, cap(w.throttle))
+	if payloadSize <= 0 || payloadSize > int64(pieceSize.Unpadded()) {
+		return DataCIDSize{}, xerrors.Errorf("invalid payload size %d for a piece of %d bytes", payloadSize, pieceSize)
 	}
-
-	// process last non-zero leaf if exists and we have data to write
-	n := len(p)
-	for len(p) > 0 {
-		buffered := int(w.len % int64(len(w.buf)))
-		toBuffer := len(w.buf) - buffered
-		if toBuffer > len(p) {
-			toBuffer = len(p)
-		}
-
-		copied := copy(w.buf[buffered:], p[:toBuffer])
-		p = p[copied:]
-		w.len += int64(copied)
-
-		// if we filled the buffer, process it
-		if copied > 0 && w.len%int64(len(w.buf)) == 0 {
-			leaf := make(chan ciderr, 1)
-			bufIdx := <-w.throttle
-			copy(w.tbufs[bufIdx][:], w.buf[:])
-
-			// process leaf in a goroutine
-			go func() {
-				defer func() {
-					w.throttle <- bufIdx
-				}()
-
-				// calculate commP for this leaf and send it to the channel
-				cc := new(commp.Calc)
-				_, _ = cc.Write(w.tbufs[bufIdx][:])
-				p, _, _ := cc.Digest()
-				l, _ := commcid.PieceCommitmentV1ToCID(p)
-				leaf <- ciderr{
-					c:   l,
-					err: nil,
-				}
-			}()
-
-			// add leaf to list
-			w.leaves = append(w.leaves, leaf)
-		}
+	// a sum taken with other opts has another piece size
+	if padded := cfg.paddedSize(); padded != 0 && pieceSize != padded {
+		return DataCIDSize{}, xerrors.Errorf("piece of %d bytes is not padded to %d bytes", pieceSize, padded)
 	}
-	return n, nil
-}
-
-func (w *CommpWriter) Sum() (DataCIDSize, error) {
-	// process last non-zero leaf if exists
-	lastLen := w.len % int64(len(w.buf))
-	rawLen := w.len
-
-	// wait for all leaves to finish
-	leaves := make([]cid.Cid, len(w.leaves))
-	for i, leaf := range w.leaves {
-		r := <-leaf
-		if r.err != nil {
-			return DataCIDSize{}, xerrors.Errorf("processing leaf %d: %w", i, r.err)
-		}
-		leaves[i] = r.c
+	if cfg.paddedSize() == 0 && pieceSize > minPieceSize && payloadSize <= int64((pieceSize/2).Unpadded()) {
+		return DataCIDSize{}, xerrors.Errorf("piece of %d bytes is larger than the payload of %d bytes needs", pieceSize, payloadSize)
 	}
-
-	// process remaining bit of data
-	if lastLen != 0 {
-		if len(leaves) != 0 {
-			copy(w.buf[lastLen:], make([]byte, int(int64(CommPBuf)-lastLen)))
-			lastLen = int64(CommPBuf)
-		}
-
-		cc := new(commp.Calc)
-		_, _ = cc.Write(w.buf[:lastLen])
-		pb, pps, _ := cc.Digest()
-		p, _ := commcid.PieceCommitmentV1ToCID(pb)
-
-		// if the last piece is less than CommPBuf, we're done
-		if abi.PaddedPieceSize(pps).Unpadded() < CommPBuf {
-			return DataCIDSize{
-				PayloadSize: w.len,
-				PieceSize:   abi.PaddedPieceSize(pps),
-				PieceCID:    p,
-			}, nil
-		}
-
-		leaves = append(leaves, p)
+	commP, err := cidCommitment(pieceCID)
+	if err != nil {
+		return DataCIDSize{}, xerrors.Errorf("invalid piece CID: %w", err)
 	}
 
-	// pad with zero pieces to power-of-two size
-	fillerLeaves := (1 << (bits.Len(uint(len(leaves) - 1)))) - len(leaves)
-	for i := 0; i < fillerLeaves; i++ {
-		leaves = append(leaves, zerocomm.ZeroPieceCommitment(CommPBuf))
-	}
+	leafLen := int64(cfg.leafSize.Unpadded())
+	return newDataCIDSize(payloadSize, pieceSize, int((payloadSize+leafLen-1)/leafLen), commP)
+}
 
-	if len(leaves) == 1 {
-		return DataCIDSize{
-			PayloadSize: rawLen,
-			PieceSize:   abi.PaddedPieceSize(len(leaves)) * commPBufPad,
-			PieceCID:    leaves[0],
-		}, nil
-	}
+// multihash and multicodec codes of FIP-0069 piece CIDs
+const (
+	fr32Sha256Trunc254Padbintree = 0x1011
+	rawCodec                     = 0x55
+)
 
-	pieces := make([]abi.PieceInfo, len(leaves))
-	for i, leaf := range leaves {
-		pieces[i] = abi.PieceInfo{
-			Size:     commPBufPad,
-			PieceCID: leaf,
-		}
+// PieceCIDv2 returns the FIP-0069 piece CID of the piece. Besides the
+// commitment, it encodes the tree height and the padding, so the piece and
+// payload sizes can be told from the CID alone.
+func (d DataCIDSize) PieceCIDv2() (cid.Cid, error) {
+	if len(d.PieceCommitment) != 32 {
+		return cid.Undef, xerrors.Errorf("invalid piece commitment of %d bytes", len(d.PieceCommitment))
 	}
-
-	p, err := nonffi.GenerateUnsealedCID(abi.RegisteredSealProof_StackedDrg32GiBV1, pieces)
-	if err != nil {
-		return DataCIDSize{}, xerrors.Errorf("generating unsealed CID: %w", err)
+	if d.PaddingSize < 0 || d.TreeHeight < 0 || d.TreeHeight > 255 {
+		return cid.Undef, xerrors.Errorf("invalid piece with %d bytes of padding and tree height %d", d.PaddingSize, d.TreeHeight)
 	}
 
-	return DataCIDSize{
-		PayloadSize: rawLen,
-		PieceSize:   abi.PaddedPieceSize(len(leaves)) * commPBufPad,
-		PieceCID:    p,
-	}, nil
+	// the digest is uvarint padding, height and root
+	digest := binary.AppendUvarint(nil, uint64(d.PaddingSize))
+	digest = append(digest, byte(d.TreeHeight))
+	digest = append(digest, d.PieceCommitment...)
+
+	mh := binary.AppendUvarint(nil, fr32Sha256Trunc254Padbintree)
+	mh = binary.AppendUvarint(mh, uint64(len(digest)))
+	mh = append(mh, digest...)
+	return cid.NewCidV1(rawCodec, mh), nil
 }
+
+// commPBufPad is the size of the buffer used to calculate commP
+const commPBufPad = abi.PaddedPieceSize(8 << 20)
+
+// CommPBuf is the size of the buffer used to calculate commP
+const CommPBuf = abi.UnpaddedPieceSize(commPBufPad - (commPBufPad / 128))
+
+// minPieceSize is the size of the smallest piece, holding 65 to 127 bytes
+const minPieceSize = abi.PaddedPieceSize(128)
+
+// maxPieceSize is the size of the largest piece, the largest power of two a
+// PaddedPieceSize holds
+const maxPieceSize = abi.PaddedPieceSize(1) << 63
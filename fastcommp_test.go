@@ -0,0 +1,137 @@
+package fastcommp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// refPieceCIDv2 returns the FIP-0069 piece CID of a payload of payloadSize
+// bytes with the commitment commP in a piece of size: a raw CID of the
+// fr32-sha256-trunc254-padbintree multihash of the padding, tree height and
+// commitment
+func refPieceCIDv2(t *testing.T, commP []byte, payloadSize int64, size abi.PaddedPieceSize) cid.Cid {
+	t.Helper()
+	digest := binary.AppendUvarint(nil, uint64(int64(size.Unpadded())-payloadSize))
+	digest = append(digest, byte(bits.TrailingZeros64(uint64(size/32))))
+	digest = append(digest, commP...)
+	mh, err := multihash.Encode(digest, 0x1011)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+func TestPieceCIDv2(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		size int
+		opts []Option
+	}{
+		{65, nil},
+		{127, nil},
+		{128, nil},
+		{1000, nil},
+		{1 << 20, nil},
+		{8 << 20, nil},
+		{100, []Option{WithTargetPieceSize(32 << 20)}},
+		{5000, []Option{WithSealProof(abi.RegisteredSealProof_StackedDrg8MiBV1_1)}},
+	} {
+		data := make([]byte, tc.size)
+		rng.Read(data)
+		sum, err := SumBytes(data, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := sum.PieceCIDv2()
+		if err != nil {
+			t.Fatal(err)
+		}
+		commP, err := commcid.CIDToPieceCommitmentV1(sum.PieceCID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := refPieceCIDv2(t, commP, int64(tc.size), sum.PieceSize); !got.Equals(want) {
+			t.Errorf("%d bytes in a piece of %d: %s, expected %s", tc.size, sum.PieceSize, got, want)
+		}
+
+		// the payload and piece sizes are told from the CID alone
+		dmh, err := multihash.Decode(got.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		padding, n := binary.Uvarint(dmh.Digest)
+		height := dmh.Digest[n]
+		if size := abi.PaddedPieceSize(32) << height; size != sum.PieceSize || int64(size.Unpadded())-int64(padding) != int64(tc.size) {
+			t.Errorf("%d bytes in a piece of %d: the CID tells %d bytes of padding in a piece of %d", tc.size, sum.PieceSize, padding, size)
+		}
+	}
+	if _, err := (DataCIDSize{PieceCommitment: make([]byte, 31)}).PieceCIDv2(); err == nil {
+		t.Errorf("the piece CID v2 of a short commitment succeeded")
+	}
+}
+
+func TestSumZeros(t *testing.T) {
+	for _, n := range []int64{65, 127, 128, 1016, 1017, 100000, 8 << 20} {
+		want, wantSize := refPieceCID(t, make([]byte, n))
+		sum, err := SumZeros(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sum.PieceCID.Equals(want) || sum.PieceSize != wantSize || sum.PayloadSize != n {
+			t.Errorf("%d zeros: %s of %d bytes, expected %s of %d", n, sum.PieceCID, sum.PieceSize, want, wantSize)
+		}
+	}
+	for size := abi.PaddedPieceSize(128); size <= 1<<20; size *= 2 {
+		want, _ := refPieceCID(t, make([]byte, size.Unpadded()))
+		got, err := ZeroPieceCID(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equals(want) {
+			t.Errorf("zero piece of %d bytes: %s, expected %s", size, got, want)
+		}
+	}
+}
+
+func TestTargetPieceSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, tc := range []struct {
+		size   int
+		target abi.PaddedPieceSize
+	}{
+		{1, 128},
+		{64, 1 << 10},
+		{127, 128},
+		{1000, 1 << 20},
+		{300000, 32 << 20},
+	} {
+		data := make([]byte, tc.size)
+		rng.Read(data)
+		name := fmt.Sprintf("%d bytes to %d", tc.size, tc.target)
+		sum, err := SumBytes(data, WithTargetPieceSize(tc.target))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		// tiny payloads are padded with zeros to 127 bytes, as the lotus
+		// client does
+		if len(data) < 127 {
+			data = append(data, make([]byte, 127-len(data))...)
+		}
+		c, size := refPieceCID(t, data)
+		if want := padCID(t, c, size, tc.target); !sum.PieceCID.Equals(want) || sum.PieceSize != tc.target || sum.PayloadSize != int64(tc.size) {
+			t.Errorf("%s: %s of %d bytes, expected %s", name, sum.PieceCID, sum.PieceSize, want)
+		}
+	}
+	if _, err := SumBytes(make([]byte, 1000), WithTargetPieceSize(512)); err == nil {
+		t.Errorf("a payload larger than the target piece size was summed")
+	}
+}
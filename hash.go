@@ -0,0 +1,49 @@
+package fastcommp
+
+import (
+	"hash"
+)
+
+// hasher adapts a CommpWriter to the hash.Hash interface
+type hasher struct {
+	w *CommpWriter
+}
+
+var _ hash.Hash = &hasher{} // make sure we are hash.Hash compliant
+
+// NewHash returns a hash.Hash backed by a CommpWriter. Sum appends the raw
+// 32-byte piece commitment rather than the piece CID.
+//
+// As with commp.Calc, calling Sum is destructive: the accumulated state is
+// reset afterwards, and Sum panics if the commitment cannot be calculated
+// (e.g. fewer than 65 bytes were written).
+func NewHash() hash.Hash {
+	return &hasher{w: new(CommpWriter)}
+}
+
+// Write adds more data to the running commitment. It never returns an error.
+func (h *hasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// Sum appends the raw piece commitment to b and resets the hash.
+func (h *hasher) Sum(b []byte) []byte {
+	sum, err := h.w.Sum()
+	if err != nil {
+		panic(err)
+	}
+	h.Reset()
+	return append(b, sum.PieceCommitment...)
+}
+
+// Reset discards all data written so far.
+func (h *hasher) Reset() {
+	h.w.Reset()
+}
+
+// Size is the size of the raw piece commitment, 32 bytes.
+func (h *hasher) Size() int { return 32 }
+
+// BlockSize is the amount of unpadded data hashed as one leaf. Writes in
+// multiples of BlockSize avoid carrying a partial leaf between calls.
+func (h *hasher) BlockSize() int { return int(CommPBuf) }
@@ -0,0 +1,100 @@
+package fastcommp
+
+import (
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Hasher calculates the raw 32-byte piece commitment of a single leaf of
+// unpadded payload. Implementations must be safe for concurrent use, as the
+// writer hashes several leaves at once.
+type Hasher interface {
+	HashLeaf(leaf []byte) ([]byte, error)
+}
+
+// calcHasher is the default Hasher, backed by commp.Calc
+type calcHasher struct{}
+
+// HashLeaf runs the leaf through a fresh commp.Calc
+func (calcHasher) HashLeaf(leaf []byte) ([]byte, error) {
+	cc := new(commp.Calc)
+	if _, err := cc.Write(leaf); err != nil {
+		return nil, err
+	}
+	commP, _, err := cc.Digest()
+	return commP, err
+}
+
+// commitment is a raw 32-byte piece commitment. Commitments are carried
+// through the tree as is and only wrapped in a CID at the API boundary.
+type commitment [32]byte
+
+// newCommitment copies a raw commitment returned by commp.Calc or a Hasher
+func newCommitment(commP []byte) (commitment, error) {
+	var c commitment
+	if len(commP) != len(c) {
+		return c, xerrors.Errorf("commitment is %d bytes, expected %d", len(commP), len(c))
+	}
+	copy(c[:], commP)
+	return c, nil
+}
+
+// cidCommitment extracts the raw commitment of a piece CID
+func cidCommitment(p cid.Cid) (commitment, error) {
+	commP, err := commcid.CIDToPieceCommitmentV1(p)
+	if err != nil {
+		return commitment{}, err
+	}
+	return newCommitment(commP)
+}
+
+// pieceCID wraps the commitment in a piece CID
+func (c commitment) pieceCID() (cid.Cid, error) {
+	return commcid.PieceCommitmentV1ToCID(c[:])
+}
+
+// leafCIDs wraps leaf commitments in CIDs for the public API
+func leafCIDs(leaves []commitment) ([]cid.Cid, error) {
+	cids := make([]cid.Cid, len(leaves))
+	for i, leaf := range leaves {
+		c, err := leaf.pieceCID()
+		if err != nil {
+			return nil, xerrors.Errorf("converting leaf %d commitment: %w", i, err)
+		}
+		cids[i] = c
+	}
+	return cids, nil
+}
+
+// leafCommitments extracts the raw commitments of leaf CIDs
+func leafCommitments(cids []cid.Cid) ([]commitment, error) {
+	leaves := make([]commitment, len(cids))
+	for i, c := range cids {
+		leaf, err := cidCommitment(c)
+		if err != nil {
+			return nil, xerrors.Errorf("decoding leaf %d commitment: %w", i, err)
+		}
+		leaves[i] = leaf
+	}
+	return leaves, nil
+}
+
+// hashLeaf calculates the piece commitment of one full leaf
+func (c config) hashLeaf(leaf []byte) (commitment, error) {
+	commP, err := c.hasher.HashLeaf(leaf)
+	if err != nil {
+		return commitment{}, xerrors.Errorf("hashing leaf: %w", err)
+	}
+	l, err := newCommitment(commP)
+	if err != nil {
+		return commitment{}, xerrors.Errorf("converting leaf commitment: %w", err)
+	}
+	return l, nil
+}
+
+// leafError annotates err with the index and payload offset of leaf i
+func (c config) leafError(i int, err error) error {
+	return xerrors.Errorf("processing leaf %d at offset %d: %w", i, int64(i)*int64(c.leafSize.Unpadded()), err)
+}
@@ -0,0 +1,50 @@
+package fastcommp
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"math/rand"
+	"testing"
+
+	sha256simd "github.com/minio/sha256-simd"
+)
+
+// BenchmarkHashLeaf measures leaf hashing, the hot loop of the writer, with
+// the SHA256Backend of this machine
+func BenchmarkHashLeaf(b *testing.B) {
+	for _, leafSize := range []int{128 << 10, 1 << 20, 8 << 20} {
+		leaf := make([]byte, leafSize/128*127)
+		rand.New(rand.NewSource(1)).Read(leaf)
+		b.Run(fmt.Sprintf("%s/%dKiB", SHA256Backend(), leafSize>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(leaf)))
+			for i := 0; i < b.N; i++ {
+				if _, err := (calcHasher{}).HashLeaf(leaf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkHashNode compares the node hash of the piece tree through
+// sha256-simd, which takes the SHA extensions of the CPU, with the standard
+// library
+func BenchmarkHashNode(b *testing.B) {
+	var left, right commitment
+	rand.New(rand.NewSource(2)).Read(left[:])
+	for _, h := range []struct {
+		name string
+		h    hash.Hash
+	}{
+		{"sha256-simd/" + SHA256Backend(), sha256simd.New()},
+		{"crypto-sha256", sha256.New()},
+	} {
+		b.Run(h.name, func(b *testing.B) {
+			b.SetBytes(64)
+			for i := 0; i < b.N; i++ {
+				right = hashNode(h.h, left, right)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package fastcommp
+
+import (
+	"encoding/hex"
+	"hash"
+	"math/bits"
+	"sort"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	sha256simd "github.com/minio/sha256-simd"
+	"golang.org/x/xerrors"
+)
+
+// ProofNode is a node of a piece tree in a merkle proof, hex-encoded as
+// text
+type ProofNode [32]byte
+
+func (n ProofNode) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(n[:])), nil
+}
+
+func (n *ProofNode) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil || len(b) != len(n) {
+		return xerrors.Errorf("invalid proof node %q, expected %d bytes in hex", text, len(n))
+	}
+	copy(n[:], b)
+	return nil
+}
+
+// MerkleProof proves that a subtree is in a piece tree
+type MerkleProof struct {
+	// Index is the position of the subtree among the subtrees of its size
+	Index uint64
+	// Path are the siblings of the subtree and of its ancestors, from the
+	// subtree up to the root
+	Path []ProofNode
+}
+
+// InclusionProof is the FRC-0058 proof of data segment inclusion (PODSI) of
+// a piece in an aggregate deal
+type InclusionProof struct {
+	// Subtree proves that the piece is the subtree at its offset
+	Subtree MerkleProof
+	// Index proves that the data segment index holds the entry of the
+	// piece, as the subtree of its two nodes
+	Index MerkleProof
+}
+
+// InclusionProofs returns the proof of inclusion of each of the Pieces of an
+// AggregateDeal, for the clients of the aggregator to verify that their
+// data is in the deal
+func (a Aggregate) InclusionProofs() ([]InclusionProof, error) {
+	if a.Index == nil {
+		return nil, xerrors.New("the aggregate has no data segment index")
+	}
+	t, err := newAggregateTree(a)
+	if err != nil {
+		return nil, err
+	}
+	proofs := make([]InclusionProof, len(a.Pieces))
+	for i, p := range a.Pieces {
+		entry := a.IndexOffset + abi.PaddedPieceSize(i*SegmentEntrySize)
+		proofs[i] = InclusionProof{
+			Subtree: t.proof(p.Offset, p.Size),
+			Index:   t.proof(entry, SegmentEntrySize),
+		}
+	}
+	return proofs, nil
+}
+
+// aggregateTree computes the nodes of the piece tree of an aggregate deal
+// from the roots of its pieces and the nodes of its index
+type aggregateTree struct {
+	size abi.PaddedPieceSize
+	// parts are the pieces and zero pieces, by offset
+	parts  []PlacedPiece
+	commPs []commitment
+	// indexOffset and index are the offset and levels of the index tree,
+	// from its nodes up
+	indexOffset abi.PaddedPieceSize
+	index       [][]commitment
+	h           hash.Hash
+}
+
+func newAggregateTree(a Aggregate) (*aggregateTree, error) {
+	t := &aggregateTree{size: a.PieceSize, indexOffset: a.IndexOffset, h: sha256simd.New()}
+	t.parts = append(append(t.parts, a.Pieces...), a.ZeroPieces...)
+	sort.Slice(t.parts, func(i, j int) bool {
+		return t.parts[i].Offset < t.parts[j].Offset
+	})
+	for _, p := range t.parts {
+		commP, err := cidCommitment(p.PieceCID)
+		if err != nil {
+			return nil, xerrors.Errorf("piece at offset %d: %w", p.Offset, err)
+		}
+		t.commPs = append(t.commPs, commP)
+	}
+
+	nodes, err := segmentIndex(a.PieceSize, a.Index)
+	if err != nil {
+		return nil, err
+	}
+	level := make([]commitment, len(nodes)/32)
+	for i := range level {
+		copy(level[i][:], nodes[i*32:])
+	}
+	t.index = append(t.index, level)
+	for len(level) > 1 {
+		up := make([]commitment, len(level)/2)
+		for i := range up {
+			up[i] = hashNode(t.h, level[2*i], level[2*i+1])
+		}
+		t.index = append(t.index, up)
+		level = up
+	}
+	return t, nil
+}
+
+// proof returns the proof of the subtree of size at offset
+func (t *aggregateTree) proof(offset, size abi.PaddedPieceSize) MerkleProof {
+	p := MerkleProof{Index: uint64(offset / size)}
+	for ; size < t.size; size *= 2 {
+		start := offset &^ (size - 1)
+		p.Path = append(p.Path, ProofNode(t.root(start^size, size)))
+	}
+	return p
+}
+
+// root returns the root of the subtree of size at offset
+func (t *aggregateTree) root(offset, size abi.PaddedPieceSize) commitment {
+	if offset >= t.indexOffset {
+		level := t.index[bits.TrailingZeros64(uint64(size/32))]
+		return level[(offset-t.indexOffset)/size]
+	}
+	// the part the subtree starts in
+	i := sort.Search(len(t.parts), func(i int) bool {
+		return t.parts[i].Offset > offset
+	}) - 1
+	part := t.parts[i]
+	switch {
+	case part.Offset == offset && part.Size == size:
+		return t.commPs[i]
+	case part.Size > size:
+		// only the siblings of subtrees in zero pieces are within a piece
+		return zeroCommitment(size)
+	}
+	left, right := t.root(offset, size/2), t.root(offset+size/2, size/2)
+	return hashNode(t.h, left, right)
+}
+
+// root returns the root of the tree that holds leaf, its subtree, along
+// the path
+func (p MerkleProof) root(leaf commitment) commitment {
+	h := sha256simd.New()
+	idx := p.Index
+	for _, sibling := range p.Path {
+		if idx&1 == 0 {
+			leaf = hashNode(h, leaf, commitment(sibling))
+		} else {
+			leaf = hashNode(h, commitment(sibling), leaf)
+		}
+		idx >>= 1
+	}
+	return leaf
+}
+
+// VerifyInclusion checks the proof that piece is in the aggregate deal, as
+// returned by InclusionProofs: that the piece is the subtree at its offset,
+// and that the data segment index of the deal holds its entry
+func VerifyInclusion(aggregate, piece abi.PieceInfo, proof InclusionProof) error {
+	if err := aggregate.Size.Validate(); err != nil {
+		return xerrors.Errorf("invalid aggregate size: %w", err)
+	}
+	if err := piece.Size.Validate(); err != nil {
+		return xerrors.Errorf("invalid piece size: %w", err)
+	}
+	if piece.Size > aggregate.Size {
+		return xerrors.Errorf("a piece of %d bytes does not fit in an aggregate of %d", piece.Size, aggregate.Size)
+	}
+	root, err := cidCommitment(aggregate.PieceCID)
+	if err != nil {
+		return xerrors.Errorf("invalid aggregate piece CID: %w", err)
+	}
+	commP, err := cidCommitment(piece.PieceCID)
+	if err != nil {
+		return xerrors.Errorf("invalid piece CID: %w", err)
+	}
+
+	height := bits.TrailingZeros64(uint64(aggregate.Size / piece.Size))
+	if len(proof.Subtree.Path) != height || proof.Subtree.Index >= uint64(aggregate.Size/piece.Size) {
+		return xerrors.Errorf("the subtree proof is not of a piece of %d bytes in an aggregate of %d", piece.Size, aggregate.Size)
+	}
+	if proof.Subtree.root(commP) != root {
+		return xerrors.New("the piece is not in the aggregate: its subtree proof leads to another piece CID")
+	}
+
+	// the entry the index holds for the piece at the offset it was proven at
+	offset := abi.PaddedPieceSize(proof.Subtree.Index) * piece.Size
+	entry := newSegmentEntry(PlacedPiece{PieceCID: piece.PieceCID, Size: piece.Size, Offset: offset}, commP)
+	nodes := entry.nodes(commP)
+	var left, right commitment
+	copy(left[:], nodes[:32])
+	copy(right[:], nodes[32:])
+	leaf := hashNode(sha256simd.New(), left, right)
+
+	height = bits.TrailingZeros64(uint64(aggregate.Size / SegmentEntrySize))
+	first := uint64(SegmentIndexOffset(aggregate.Size) / SegmentEntrySize)
+	if len(proof.Index.Path) != height || proof.Index.Index < first || proof.Index.Index >= uint64(aggregate.Size/SegmentEntrySize) {
+		return xerrors.Errorf("the index proof is not of an entry of the data segment index of an aggregate of %d bytes", aggregate.Size)
+	}
+	if proof.Index.root(leaf) != root {
+		return xerrors.Errorf("the data segment index of the aggregate has no entry for the piece at offset %d", offset)
+	}
+	return nil
+}
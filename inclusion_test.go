@@ -0,0 +1,254 @@
+package fastcommp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// refTruncatedHash is TruncatedHash of go-data-segment: the sha256 of a pair
+// of nodes, truncated to 254 bits
+func refTruncatedHash(pair []byte) []byte {
+	h := sha256.Sum256(pair)
+	h[31] &= 0x3f
+	return h[:]
+}
+
+// refComputeRoot is ComputeRoot of a go-data-segment ProofData: the root of
+// the tree holding leaf at index, along path
+func refComputeRoot(leaf []byte, index uint64, path []ProofNode) []byte {
+	for _, sibling := range path {
+		if index&1 == 0 {
+			leaf = refTruncatedHash(append(append([]byte(nil), leaf...), sibling[:]...))
+		} else {
+			leaf = refTruncatedHash(append(append([]byte(nil), sibling[:]...), leaf...))
+		}
+		index >>= 1
+	}
+	return leaf
+}
+
+// refCheckInclusion checks proof as ComputeExpectedAuxData of go-data-segment
+// does, returning the commitment and size of the aggregate it proves the
+// piece to be in
+func refCheckInclusion(t *testing.T, piece abi.PieceInfo, proof InclusionProof) ([]byte, abi.PaddedPieceSize) {
+	t.Helper()
+	commPc, err := commcid.CIDToPieceCommitmentV1(piece.PieceCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commPa := refComputeRoot(commPc, proof.Subtree.Index, proof.Subtree.Path)
+	size := piece.Size << len(proof.Subtree.Path)
+	offset := proof.Subtree.Index * uint64(piece.Size)
+
+	entry := refEntry(commPc, offset, uint64(piece.Size))
+	commPa2 := refComputeRoot(refTruncatedHash(entry), proof.Index.Index, proof.Index.Path)
+	if !bytes.Equal(commPa, commPa2) {
+		t.Fatalf("piece at %d: the subtree proof is of %x, the index proof of %x", offset, commPa, commPa2)
+	}
+	if abi.PaddedPieceSize(SegmentEntrySize)<<len(proof.Index.Path) != size {
+		t.Fatalf("piece at %d: the index proof is of another aggregate size", offset)
+	}
+	start := uint64(size) - uint64(MaxSegmentEntries(size))*SegmentEntrySize
+	if proof.Index.Index < start/SegmentEntrySize || proof.Index.Index >= uint64(size)/SegmentEntrySize {
+		t.Fatalf("piece at %d: entry %d is outside the index area", offset, proof.Index.Index)
+	}
+	return commPa, size
+}
+
+func TestInclusionProofs(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, tc := range []struct {
+		dealSize abi.PaddedPieceSize
+		pieces   int
+		max      int
+	}{
+		{0, 1, 1000},
+		{0, 5, 5000},
+		{1 << 20, 8, 60000},
+		{32 << 20, 30, 500000},
+	} {
+		pieces, _ := testPieces(t, rng, tc.pieces, tc.max)
+		agg, err := AggregateDeal(tc.dealSize, pieces)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs, err := agg.InclusionProofs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := commcid.CIDToPieceCommitmentV1(agg.PieceCID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range agg.Pieces {
+			piece := abi.PieceInfo{Size: p.Size, PieceCID: p.PieceCID}
+			commPa, size := refCheckInclusion(t, piece, proofs[i])
+			if !bytes.Equal(commPa, root) || size != agg.PieceSize {
+				t.Errorf("piece %d: proven in %x of %d bytes, expected %x of %d", i, commPa, size, root, agg.PieceSize)
+			}
+			if offset := abi.PaddedPieceSize(proofs[i].Subtree.Index) * p.Size; offset != p.Offset {
+				t.Errorf("piece %d: proven at offset %d, placed at %d", i, offset, p.Offset)
+			}
+			if depth := bits.TrailingZeros64(uint64(agg.PieceSize / p.Size)); len(proofs[i].Subtree.Path) != depth {
+				t.Errorf("piece %d: subtree proof of depth %d, expected %d", i, len(proofs[i].Subtree.Path), depth)
+			}
+		}
+	}
+}
+
+func TestInclusionProofJSON(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	pieces, _ := testPieces(t, rng, 3, 3000)
+	agg, err := AggregateDeal(0, pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs, err := agg.InclusionProofs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(proofs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []InclusionProof
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, proofs) {
+		t.Errorf("the proofs changed through JSON:\n%s", data)
+	}
+
+	var n ProofNode
+	for _, text := range []string{`"00"`, `"zz"`, `"` + string(bytes.Repeat([]byte("ab"), 33)) + `"`} {
+		if err := json.Unmarshal([]byte(text), &n); err == nil {
+			t.Errorf("the proof node %s decoded", text)
+		}
+	}
+}
+
+// refFr32Pad returns the Fr32 padded form of data, a multiple of 127 bytes:
+// each 32-byte node holds 254 bits of it, least significant bit first
+func refFr32Pad(data []byte) []byte {
+	out := make([]byte, len(data)/127*128)
+	for i := 0; i < len(data)*8; i++ {
+		if data[i/8]&(1<<(i%8)) != 0 {
+			dst := i/254*256 + i%254
+			out[dst/8] |= 1 << (dst % 8)
+		}
+	}
+	return out
+}
+
+// refTree returns the levels of the piece tree of a padded payload, from
+// its nodes up to the root
+func refTree(padded []byte) [][]byte {
+	levels := [][]byte{padded}
+	for level := padded; len(level) > 32; {
+		up := make([]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 64 {
+			up = append(up, refTruncatedHash(level[i:i+64])...)
+		}
+		levels = append(levels, up)
+		level = up
+	}
+	return levels
+}
+
+// refProof returns the proof of the subtree of size at offset of the tree,
+// built from its full levels
+func refProof(levels [][]byte, offset, size abi.PaddedPieceSize) MerkleProof {
+	depth := bits.TrailingZeros64(uint64(size / 32))
+	p := MerkleProof{Index: uint64(offset / size)}
+	for i, level := range levels[depth : len(levels)-1] {
+		var sibling ProofNode
+		at := (p.Index >> i) ^ 1
+		copy(sibling[:], level[at*32:])
+		p.Path = append(p.Path, sibling)
+	}
+	return p
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	pieces, payloads := testPieces(t, rng, 6, 20000)
+	agg, err := AggregateDeal(1<<20, pieces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deal := make([]byte, agg.PieceSize.Unpadded())
+	for i, p := range agg.Pieces {
+		copy(deal[p.Offset.Unpadded():], payloads[i])
+	}
+	index, err := agg.SegmentIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(deal[agg.IndexOffset.Unpadded():], index)
+	levels := refTree(refFr32Pad(deal))
+	root, err := commcid.CIDToPieceCommitmentV1(agg.PieceCID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(levels[len(levels)-1], root) {
+		t.Fatalf("the deal payload is not %s", agg.PieceCID)
+	}
+
+	proofs, err := agg.InclusionProofs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aggregate := abi.PieceInfo{Size: agg.PieceSize, PieceCID: agg.PieceCID}
+	for i, p := range agg.Pieces {
+		piece := abi.PieceInfo{Size: p.Size, PieceCID: p.PieceCID}
+		entry := agg.IndexOffset + abi.PaddedPieceSize(i*SegmentEntrySize)
+		ref := InclusionProof{
+			Subtree: refProof(levels, p.Offset, p.Size),
+			Index:   refProof(levels, entry, SegmentEntrySize),
+		}
+		if !reflect.DeepEqual(proofs[i], ref) {
+			t.Errorf("piece %d: the proof is not that of the full tree", i)
+		}
+		if err := VerifyInclusion(aggregate, piece, ref); err != nil {
+			t.Errorf("piece %d: %s", i, err)
+		}
+	}
+
+	// proofs that must not hold
+	piece := abi.PieceInfo{Size: agg.Pieces[1].Size, PieceCID: agg.Pieces[1].PieceCID}
+	other := abi.PieceInfo{Size: agg.Pieces[2].Size, PieceCID: agg.Pieces[2].PieceCID}
+	tamper := func(f func(p *InclusionProof)) InclusionProof {
+		p := proofs[1]
+		p.Subtree.Path = append([]ProofNode(nil), p.Subtree.Path...)
+		p.Index.Path = append([]ProofNode(nil), p.Index.Path...)
+		f(&p)
+		return p
+	}
+	for _, tc := range []struct {
+		name             string
+		aggregate, piece abi.PieceInfo
+		proof            InclusionProof
+	}{
+		{"another piece", aggregate, other, proofs[1]},
+		{"another aggregate", abi.PieceInfo{Size: agg.PieceSize, PieceCID: agg.Pieces[0].PieceCID}, piece, proofs[1]},
+		{"another aggregate size", abi.PieceInfo{Size: agg.PieceSize * 2, PieceCID: agg.PieceCID}, piece, proofs[1]},
+		{"another index entry", aggregate, piece, tamper(func(p *InclusionProof) { p.Index = proofs[2].Index })},
+		{"tampered subtree path", aggregate, piece, tamper(func(p *InclusionProof) { p.Subtree.Path[0][0] ^= 1 })},
+		{"tampered index path", aggregate, piece, tamper(func(p *InclusionProof) { p.Index.Path[3][5] ^= 1 })},
+		{"shifted subtree", aggregate, piece, tamper(func(p *InclusionProof) { p.Subtree.Index ^= 1 })},
+		{"short subtree path", aggregate, piece, tamper(func(p *InclusionProof) { p.Subtree.Path = p.Subtree.Path[1:] })},
+		{"entry outside the index", aggregate, piece, tamper(func(p *InclusionProof) { p.Index.Index = 0 })},
+	} {
+		if err := VerifyInclusion(tc.aggregate, tc.piece, tc.proof); err == nil {
+			t.Errorf("%s: the proof holds", tc.name)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package fastcommp
+
+import (
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// PartialResult is the CommP progress over one contiguous range of a payload.
+// Ranges can be hashed independently, on different goroutines or machines,
+// and combined into the piece CID of the whole payload with Merge.
+type PartialResult struct {
+	// PayloadSize is the number of payload bytes in the range
+	PayloadSize int64
+	// LeafSize is the padded leaf size the range was hashed with
+	LeafSize abi.PaddedPieceSize
+	// Leaves are the commitments of the full leaves in the range
+	Leaves []cid.Cid
+	// Tail holds the bytes past the last full leaf
+	Tail []byte
+}
+
+// Partial waits for all outstanding leaves and returns the progress of the
+// writer as a PartialResult. Every range other than the last one of a payload
+// must be a multiple of the unpadded leaf size, so that only the final
+// PartialResult has a Tail. The writer remains usable.
+func (w *CommpWriter) Partial() (PartialResult, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+	if w.stack != nil {
+		return PartialResult{}, xerrors.New("partial results are not available in streaming mode")
+	}
+
+	resolved, err := w.resolveLeaves()
+	if err != nil {
+		return PartialResult{}, err
+	}
+	leaves, err := leafCIDs(resolved)
+	if err != nil {
+		return PartialResult{}, err
+	}
+
+	tail := w.buf[:w.len%int64(len(w.buf))]
+	return PartialResult{
+		PayloadSize: w.len,
+		LeafSize:    w.cfg.leafSize,
+		Leaves:      leaves,
+		Tail:        append([]byte(nil), tail...),
+	}, nil
+}
+
+// Merge combines the partial results of consecutive ranges of a payload,
+// given in payload order, into the result for the whole payload.
+func Merge(parts ...PartialResult) (DataCIDSize, error) {
+	if len(parts) == 0 {
+		return DataCIDSize{}, xerrors.New("no partial results to merge")
+	}
+
+	cfg := defaultConfig()
+	cfg.leafSize = parts[0].LeafSize
+	if err := cfg.leafSize.Validate(); err != nil {
+		return DataCIDSize{}, xerrors.Errorf("invalid leaf size: %w", err)
+	}
+	leafLen := int64(cfg.leafSize.Unpadded())
+
+	var leaves []commitment
+	for i, part := range parts {
+		if part.LeafSize != cfg.leafSize {
+			return DataCIDSize{}, xerrors.Errorf("part %d has leaf size %d, expected %d", i, part.LeafSize, cfg.leafSize)
+		}
+		if int64(len(part.Leaves))*leafLen+int64(len(part.Tail)) != part.PayloadSize {
+			return DataCIDSize{}, xerrors.Errorf("part %d is inconsistent: %d bytes with %d leaves and %d tail bytes", i, part.PayloadSize, len(part.Leaves), len(part.Tail))
+		}
+		if int64(len(part.Tail)) >= leafLen {
+			return DataCIDSize{}, xerrors.Errorf("part %d has a tail of %d bytes, which is not shorter than a leaf", i, len(part.Tail))
+		}
+		if len(part.Tail) != 0 && i != len(parts)-1 {
+			return DataCIDSize{}, xerrors.Errorf("part %d is not leaf-aligned but is not the last part", i)
+		}
+		partLeaves, err := leafCommitments(part.Leaves)
+		if err != nil {
+			return DataCIDSize{}, xerrors.Errorf("part %d: %w", i, err)
+		}
+		leaves = append(leaves, partLeaves...)
+	}
+
+	// sumLeaves zero-fills the tail in place, so hand it a leaf-sized copy
+	var buf []byte
+	last := parts[len(parts)-1]
+	if len(last.Tail) != 0 {
+		buf = make([]byte, leafLen)
+		copy(buf, last.Tail)
+	}
+	start := time.Now()
+	sum, err := cfg.sumLeaves(leaves, buf, len(last.Tail))
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+	sum.Timings.Tree = time.Since(start)
+	return sum, nil
+}
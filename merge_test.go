@@ -0,0 +1,86 @@
+package fastcommp
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// partials hashes the ranges of data ending at ends on writers of their own
+func partials(t *testing.T, data []byte, ends []int, opts ...Option) []PartialResult {
+	t.Helper()
+	var parts []PartialResult
+	start := 0
+	for _, end := range ends {
+		w, err := NewCommpWriter(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data[start:end]); err != nil {
+			t.Fatal(err)
+		}
+		part, err := w.Partial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		parts = append(parts, part)
+		start = end
+	}
+	return parts
+}
+
+func TestMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, leafSize := range []abi.PaddedPieceSize{128, 1024} {
+		leaf := int(leafSize.Unpadded())
+		for _, size := range []int{65, 127, 5000, 40000, 40 * 1016} {
+			data := sparsePayload(rng, size, leafSize)
+			want, wantSize := refPieceCID(t, data)
+			for n := 1; n <= 5; n++ {
+				// n ranges, all but the last a multiple of the leaf
+				var ends []int
+				for end := 0; len(ends) < n-1; {
+					end += leaf * rng.Intn(1+size/leaf/n)
+					if end >= size {
+						break
+					}
+					ends = append(ends, end)
+				}
+				ends = append(ends, size)
+				name := fmt.Sprintf("%d bytes in ranges ending at %v/leaf %d", size, ends, leafSize)
+				sum, err := Merge(partials(t, data, ends, WithLeafBufferSize(leafSize))...)
+				if err != nil {
+					t.Fatalf("%s: %s", name, err)
+				}
+				if !sum.PieceCID.Equals(want) || sum.PieceSize != wantSize || sum.PayloadSize != int64(size) {
+					t.Errorf("%s: %s of %d bytes, expected %s of %d", name, sum.PieceCID, sum.PieceSize, want, wantSize)
+				}
+			}
+		}
+	}
+}
+
+func TestMergeInvalid(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	data := make([]byte, 3000)
+	rng.Read(data)
+	leaf := int(abi.PaddedPieceSize(256).Unpadded())
+	parts := partials(t, data, []int{leaf, 2*leaf + 10, 3000}, WithLeafBufferSize(256))
+	other := partials(t, data, []int{3000}, WithLeafBufferSize(512))
+	for _, tc := range []struct {
+		name  string
+		parts []PartialResult
+	}{
+		{"no parts", nil},
+		{"a tail before the last part", parts},
+		{"different leaf sizes", []PartialResult{parts[0], other[0]}},
+		{"inconsistent part", []PartialResult{{PayloadSize: 10, LeafSize: 256}}},
+	} {
+		if _, err := Merge(tc.parts...); err == nil {
+			t.Errorf("%s merged", tc.name)
+		}
+	}
+}
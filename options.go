@@ -0,0 +1,167 @@
+package fastcommp
+
+import (
+	"runtime"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"golang.org/x/xerrors"
+)
+
+// config holds the tunables of a CommpWriter
+type config struct {
+	concurrency int
+	leafSize    abi.PaddedPieceSize
+	hasher      Hasher
+	streaming   bool
+	progress    func(bytesHashed int64, leavesDone int)
+	// sealProof is the proof of the sector the piece is padded to, nil for a
+	// piece just large enough for the payload
+	sealProof *abi.RegisteredSealProof
+	// targetSize is the size the piece is padded to by WithTargetPieceSize,
+	// 0 for none
+	targetSize abi.PaddedPieceSize
+}
+
+// defaultConfig is used by NewCommpWriter and by zero-value writers
+func defaultConfig() config {
+	return config{
+		concurrency: runtime.GOMAXPROCS(0),
+		leafSize:    commPBufPad,
+		hasher:      calcHasher{},
+	}
+}
+
+// newConfig returns the default config changed by opts. Leaves larger than
+// the piece it is padded to shrink to it, so as not to hold buffers larger
+// than the whole piece.
+func newConfig(opts []Option) (config, error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+	if padded := cfg.paddedSize(); padded < cfg.leafSize && padded != 0 {
+		cfg.leafSize = padded
+	}
+	return cfg, nil
+}
+
+// validate checks that the config describes a usable writer
+func (c config) validate() error {
+	if c.concurrency < 1 {
+		return xerrors.Errorf("concurrency must be at least 1, got %d", c.concurrency)
+	}
+	if err := c.leafSize.Validate(); err != nil {
+		return xerrors.Errorf("invalid leaf buffer size: %w", err)
+	}
+	if c.hasher == nil {
+		return xerrors.New("hasher must not be nil")
+	}
+	if c.sealProof != nil {
+		if _, err := c.sealProof.SectorSize(); err != nil {
+			return xerrors.Errorf("invalid seal proof: %w", err)
+		}
+	}
+	if c.targetSize != 0 {
+		if err := c.targetSize.Validate(); err != nil {
+			return xerrors.Errorf("invalid target piece size: %w", err)
+		}
+		if c.sealProof != nil {
+			return xerrors.New("a piece is padded either to a target piece size or to a sector, not both")
+		}
+	}
+	return nil
+}
+
+// sectorSize is the padded size of the sector of the seal proof, or 0
+// without one
+func (c config) sectorSize() abi.PaddedPieceSize {
+	if c.sealProof == nil {
+		return 0
+	}
+	ss, _ := c.sealProof.SectorSize()
+	return abi.PaddedPieceSize(ss)
+}
+
+// paddedSize is the size the piece is padded to, the target piece size or
+// the sector of the seal proof, or 0 for neither
+func (c config) paddedSize() abi.PaddedPieceSize {
+	if c.targetSize != 0 {
+		return c.targetSize
+	}
+	return c.sectorSize()
+}
+
+// Option configures a CommpWriter
+type Option func(*config)
+
+// WithConcurrency sets the number of leaves hashed in parallel, and with it
+// the number of leaf buffers held by the writer. Defaults to GOMAXPROCS,
+// which follows the CPU quota of the cgroup the process runs in.
+func WithConcurrency(n int) Option {
+	return func(c *config) {
+		c.concurrency = n
+	}
+}
+
+// WithLeafBufferSize sets the padded size of a single leaf. It must be a
+// power of two no smaller than 128 bytes; each leaf buffer holds
+// sz.Unpadded() bytes of payload. Defaults to 8MiB.
+func WithLeafBufferSize(sz abi.PaddedPieceSize) Option {
+	return func(c *config) {
+		c.leafSize = sz
+	}
+}
+
+// WithHasher replaces the Hasher used to calculate leaf commitments.
+func WithHasher(h Hasher) Option {
+	return func(c *config) {
+		c.hasher = h
+	}
+}
+
+// WithStreaming makes the writer fold completed leaves into a merkle stack
+// as it goes, so memory stays O(log n) in the number of leaves instead of
+// keeping every leaf commitment until Sum. Partial is not available on a
+// streaming writer.
+func WithStreaming() Option {
+	return func(c *config) {
+		c.streaming = true
+	}
+}
+
+// WithSealProof pads the piece with zeros up to the size of a sector of the
+// seal proof p, such as abi.RegisteredSealProof_StackedDrg64GiBV1_1, making
+// its commitment that of a sector holding just the payload. Payloads that do
+// not fit in the sector fail, and payloads of under 127 bytes are padded with
+// zeros like the lotus client does, so that even a few bytes have a piece.
+// Leaves shrink to the sector when it is smaller. By default the piece is the
+// smallest power of two that holds the payload.
+func WithSealProof(p abi.RegisteredSealProof) Option {
+	return func(c *config) {
+		c.sealProof = &p
+	}
+}
+
+// WithTargetPieceSize pads the piece with zeros up to size, a power of two
+// of at least 128 bytes, like WithSealProof does to a sector, for deals made
+// at a fixed piece size larger than the payload. Payloads that do not fit
+// fail.
+func WithTargetPieceSize(size abi.PaddedPieceSize) Option {
+	return func(c *config) {
+		c.targetSize = size
+	}
+}
+
+// WithProgress registers fn to be called each time a leaf has been hashed,
+// with the number of payload bytes hashed so far and the number of leaves
+// done, and once more by Sum with the totals including the payload tail.
+// Calls are not concurrent but come from the hashing goroutines, so fn should
+// return quickly.
+func WithProgress(fn func(bytesHashed int64, leavesDone int)) Option {
+	return func(c *config) {
+		c.progress = fn
+	}
+}
@@ -0,0 +1,74 @@
+package fastcommp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// leafJob is a full leaf waiting for a hashing worker
+type leafJob struct {
+	ctx    context.Context
+	buf    []byte
+	result chan<- leafResult
+
+	// progress is told about the leaf once it has been hashed
+	progress *progress
+
+	// slot, if set, is released once the worker has handed buf back to the
+	// shared buffer pool
+	slot <-chan struct{}
+}
+
+// workerPool is a fixed set of goroutines hashing leaves taken from a
+// bounded queue. Submitting blocks while the queue is full, so a producer
+// that outruns the hashers is slowed down instead of piling up goroutines.
+type workerPool struct {
+	jobs chan leafJob
+	wg   sync.WaitGroup
+}
+
+// startWorkers starts cfg.concurrency workers hashing leaves with cfg
+func startWorkers(cfg config) *workerPool {
+	p := &workerPool{
+		jobs: make(chan leafJob, cfg.concurrency),
+	}
+	p.wg.Add(cfg.concurrency)
+	for i := 0; i < cfg.concurrency; i++ {
+		go func() {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				r := leafResult{err: j.ctx.Err()}
+				start := time.Now()
+				if r.err == nil {
+					r.commP, r.err = cfg.hashLeaf(j.buf)
+				}
+				if r.err == nil {
+					j.progress.leafHashed(time.Since(start))
+				}
+				j.result <- r
+				putLeafBuf(j.buf)
+				if j.slot != nil {
+					<-j.slot
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues j, giving up when ctx is canceled first
+func (p *workerPool) submit(ctx context.Context, j leafJob) error {
+	select {
+	case p.jobs <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop lets the workers finish the queued jobs and waits for them to exit
+func (p *workerPool) stop() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,50 @@
+package fastcommp
+
+import (
+	"sync"
+	"time"
+)
+
+// progress counts the leaves hashed by one writer and the time spent on them,
+// and reports them to the WithProgress callback, if any, one call at a time
+type progress struct {
+	fn      func(bytesHashed int64, leavesDone int)
+	leafLen int64
+
+	mu      sync.Mutex
+	leaves  int
+	hashing time.Duration
+}
+
+// newProgress returns a progress starting at leaves hashed leaves
+func newProgress(cfg config, leaves int) *progress {
+	return &progress{
+		fn:      cfg.progress,
+		leafLen: int64(cfg.leafSize.Unpadded()),
+		leaves:  leaves,
+	}
+}
+
+// leafHashed reports one more full leaf, hashed in d
+func (p *progress) leafHashed(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.leaves++
+	p.hashing += d
+	if p.fn != nil {
+		p.fn(int64(p.leaves)*p.leafLen, p.leaves)
+	}
+}
+
+// done records the hashing time in sum and reports the final result, which
+// includes the payload tail
+func (p *progress) done(sum *DataCIDSize) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sum.Timings.Hash = p.hashing
+	if p.fn != nil {
+		p.fn(sum.PayloadSize, sum.LeafCount)
+	}
+}
@@ -0,0 +1,170 @@
+package fastcommp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// SumReaderAt calculates the CommP of the first size bytes of r. Instead of
+// funneling the payload through a single sequential reader, each hashing
+// worker reads whole leaves from r on its own, which keeps fast storage busy
+// with several reads at once. r must support concurrent ReadAt calls, as
+// *os.File does.
+func SumReaderAt(r io.ReaderAt, size int64, opts ...Option) (DataCIDSize, error) {
+	return SumReaderAtContext(context.Background(), r, size, opts...)
+}
+
+// SumReaderAtContext is like SumReaderAt, but stops reading and returns
+// ctx.Err() when ctx is canceled.
+func SumReaderAtContext(ctx context.Context, r io.ReaderAt, size int64, opts ...Option) (DataCIDSize, error) {
+	return sumParallel(ctx, size, opts, func(buf []byte, off int64) ([]byte, error) {
+		if err := readAtFull(r, buf, off); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	})
+}
+
+// SumBytes calculates the CommP of data, hashing its leaves in place on
+// several goroutines instead of copying them into leaf buffers first. This
+// suits payloads that are already in memory or memory-mapped.
+func SumBytes(data []byte, opts ...Option) (DataCIDSize, error) {
+	return SumBytesContext(context.Background(), data, opts...)
+}
+
+// SumBytesContext is like SumBytes, but stops hashing and returns ctx.Err()
+// when ctx is canceled.
+func SumBytesContext(ctx context.Context, data []byte, opts ...Option) (DataCIDSize, error) {
+	return sumParallel(ctx, int64(len(data)), opts, func(buf []byte, off int64) ([]byte, error) {
+		return data[off : off+int64(len(buf))], nil
+	})
+}
+
+// sumParallel calculates the CommP of a payload of size bytes whose leaves
+// can be fetched in any order. leaf returns the len(buf) bytes at off, either
+// read into buf or from wherever the payload already is.
+func sumParallel(ctx context.Context, size int64, opts []Option, leaf func(buf []byte, off int64) ([]byte, error)) (DataCIDSize, error) {
+	if size < 0 {
+		return DataCIDSize{}, xerrors.Errorf("invalid payload size %d", size)
+	}
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	leafLen := int64(cfg.leafSize.Unpadded())
+	leaves := make([]commitment, size/leafLen)
+	prog := newProgress(cfg, 0)
+
+	var (
+		next     int64
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	workers := cfg.concurrency
+	if workers > len(leaves) {
+		workers = len(leaves)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := getLeafBuf(int(leafLen))
+			defer putLeafBuf(buf)
+			for {
+				idx := atomic.AddInt64(&next, 1) - 1
+				if idx >= int64(len(leaves)) {
+					return
+				}
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+
+				data, err := leaf(buf, idx*leafLen)
+				if err != nil {
+					fail(cfg.leafError(int(idx), err))
+					return
+				}
+				start := time.Now()
+				l, err := cfg.hashLeaf(data)
+				if err != nil {
+					fail(cfg.leafError(int(idx), err))
+					return
+				}
+				leaves[idx] = l
+				prog.leafHashed(time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return DataCIDSize{}, firstErr
+	}
+
+	// process remaining bit of data, copied as it gets zero-padded in place
+	tailLen := int(size % leafLen)
+	var buf []byte
+	if tailLen != 0 {
+		buf = getLeafBuf(int(leafLen))
+		defer putLeafBuf(buf)
+		data, err := leaf(buf[:tailLen], int64(len(leaves))*leafLen)
+		if err != nil {
+			return DataCIDSize{}, cfg.leafError(len(leaves), err)
+		}
+		copy(buf, data)
+	}
+	start := time.Now()
+	sum, err := cfg.sumLeaves(leaves, buf, tailLen)
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+	sum.Timings.Tree = time.Since(start)
+	prog.done(&sum)
+	return sum, nil
+}
+
+// SumRange calculates the CommP of the n bytes of r starting at off, as if they
+// were a payload of their own. This maps the slices of one large file to
+// separate pieces without copying them out first.
+func SumRange(r io.ReaderAt, off, n int64, opts ...Option) (DataCIDSize, error) {
+	return SumRangeContext(context.Background(), r, off, n, opts...)
+}
+
+// SumRangeContext is like SumRange, but stops reading and returns ctx.Err()
+// when ctx is canceled.
+func SumRangeContext(ctx context.Context, r io.ReaderAt, off, n int64, opts ...Option) (DataCIDSize, error) {
+	if off < 0 {
+		return DataCIDSize{}, xerrors.Errorf("invalid offset %d", off)
+	}
+	return SumReaderAtContext(ctx, io.NewSectionReader(r, off, n), n, opts...)
+}
+
+// readAtFull fills buf from r at off, treating a short read as an error
+func readAtFull(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return xerrors.Errorf("reading %d bytes at offset %d: %w", len(buf), off, err)
+}
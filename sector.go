@@ -0,0 +1,66 @@
+package fastcommp
+
+import (
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"golang.org/x/xerrors"
+)
+
+// sealProofs are the current seal proofs, by increasing sector size
+var sealProofs = []abi.RegisteredSealProof{
+	abi.RegisteredSealProof_StackedDrg2KiBV1_1,
+	abi.RegisteredSealProof_StackedDrg8MiBV1_1,
+	abi.RegisteredSealProof_StackedDrg512MiBV1_1,
+	abi.RegisteredSealProof_StackedDrg32GiBV1_1,
+	abi.RegisteredSealProof_StackedDrg64GiBV1_1,
+}
+
+// sealProofNames are the names the proofs library gives the seal proofs
+var sealProofNames = map[abi.RegisteredSealProof]string{
+	abi.RegisteredSealProof_StackedDrg2KiBV1:     "StackedDrg2KiBV1",
+	abi.RegisteredSealProof_StackedDrg8MiBV1:     "StackedDrg8MiBV1",
+	abi.RegisteredSealProof_StackedDrg512MiBV1:   "StackedDrg512MiBV1",
+	abi.RegisteredSealProof_StackedDrg32GiBV1:    "StackedDrg32GiBV1",
+	abi.RegisteredSealProof_StackedDrg64GiBV1:    "StackedDrg64GiBV1",
+	abi.RegisteredSealProof_StackedDrg2KiBV1_1:   "StackedDrg2KiBV1_1",
+	abi.RegisteredSealProof_StackedDrg8MiBV1_1:   "StackedDrg8MiBV1_1",
+	abi.RegisteredSealProof_StackedDrg512MiBV1_1: "StackedDrg512MiBV1_1",
+	abi.RegisteredSealProof_StackedDrg32GiBV1_1:  "StackedDrg32GiBV1_1",
+	abi.RegisteredSealProof_StackedDrg64GiBV1_1:  "StackedDrg64GiBV1_1",
+}
+
+// ParseSealProof returns the seal proof called name, such as
+// StackedDrg64GiBV1 or StackedDrg32GiBV1_1, with or without the
+// RegisteredSealProof_ prefix of its Go name
+func ParseSealProof(name string) (abi.RegisteredSealProof, error) {
+	name = strings.TrimPrefix(name, "RegisteredSealProof_")
+	for p, n := range sealProofNames {
+		if strings.EqualFold(n, name) {
+			return p, nil
+		}
+	}
+	return 0, xerrors.Errorf("unknown seal proof %q, such as StackedDrg32GiBV1_1 or StackedDrg64GiBV1", name)
+}
+
+// SealProofOf returns the current seal proof of sectors of size ss, for
+// WithSealProof
+func SealProofOf(ss abi.SectorSize) (abi.RegisteredSealProof, error) {
+	for _, p := range sealProofs {
+		if size, _ := p.SectorSize(); size == ss {
+			return p, nil
+		}
+	}
+	return 0, xerrors.Errorf("no seal proof for sectors of %d bytes", ss)
+}
+
+// smallestSector returns the size of the smallest sector that holds a piece
+// of pieceSize, or 0 if the piece is larger than any
+func smallestSector(pieceSize abi.PaddedPieceSize) abi.SectorSize {
+	for _, p := range sealProofs {
+		if size, _ := p.SectorSize(); abi.PaddedPieceSize(size) >= pieceSize {
+			return size
+		}
+	}
+	return 0
+}
@@ -0,0 +1,239 @@
+package fastcommp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// ShardedWriter calculates the CommP of a payload of known size whose byte
+// ranges are written with WriteAt, concurrently and in any order. Every byte
+// of the payload must be written exactly once before calling Sum.
+//
+// Each leaf touched by a write is buffered until all of its bytes have
+// arrived, so memory use grows with the number of partially written leaves;
+// writers that each stream a contiguous range keep it at one leaf per range.
+// Leaves are hashed by a fixed set of workers that a successful Sum or Close
+// releases, so call Close once done with a writer whose Sum failed or was
+// never called.
+type ShardedWriter struct {
+	cfg      config
+	size     int64
+	leafLen  int64
+	pool     *workerPool
+	progress *progress
+
+	mu      sync.Mutex
+	written int64
+	pending map[int64]*shardLeaf
+	leaves  []chan leafResult
+	tail    []byte
+	summed  bool
+	closed  bool
+}
+
+// shardLeaf is a leaf that has not been fully written yet
+type shardLeaf struct {
+	buf    []byte
+	filled int
+}
+
+var _ io.WriterAt = &ShardedWriter{}
+
+// NewShardedWriter returns a ShardedWriter for a payload of size bytes,
+// configured with opts
+func NewShardedWriter(size int64, opts ...Option) (*ShardedWriter, error) {
+	if size < 0 {
+		return nil, xerrors.Errorf("invalid payload size %d", size)
+	}
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	leafLen := int64(cfg.leafSize.Unpadded())
+	return &ShardedWriter{
+		cfg:      cfg,
+		size:     size,
+		leafLen:  leafLen,
+		pool:     startWorkers(cfg),
+		progress: newProgress(cfg, 0),
+		pending:  make(map[int64]*shardLeaf),
+		leaves:   make([]chan leafResult, size/leafLen),
+	}, nil
+}
+
+// WriteAt writes p at offset off of the payload. It is safe to call WriteAt
+// from multiple goroutines as long as the written ranges do not overlap. The
+// call that completes a leaf queues it for hashing, and blocks while the
+// queue is full.
+func (s *ShardedWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > s.size {
+		return 0, xerrors.Errorf("write of %d bytes at offset %d is outside of the %d byte payload", len(p), off, s.size)
+	}
+
+	n := 0
+	for len(p) > 0 {
+		idx := off / s.leafLen
+		start := int(off % s.leafLen)
+
+		l, err := s.leaf(idx)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(l.buf[start:], p)
+
+		s.mu.Lock()
+		l.filled += copied
+		s.written += int64(copied)
+		if l.filled > len(l.buf) {
+			s.mu.Unlock()
+			return n, xerrors.Errorf("leaf %d was written more than once", idx)
+		}
+		// a full leaf is marked complete at once, so that a later write
+		// into it fails instead of starting the leaf over
+		var result chan leafResult
+		full := l.filled == len(l.buf)
+		if full {
+			delete(s.pending, idx)
+			if int64(len(l.buf)) < s.leafLen {
+				s.tail = l.buf
+			} else {
+				result = make(chan leafResult, 1)
+				s.leaves[idx] = result
+			}
+		}
+		s.mu.Unlock()
+
+		if result != nil {
+			if err := s.complete(idx, l.buf, result); err != nil {
+				return n, err
+			}
+		}
+
+		p = p[copied:]
+		off += int64(copied)
+		n += copied
+	}
+	return n, nil
+}
+
+// leaf returns the buffer of leaf idx, allocating it on first use. The last
+// leaf is only as long as the payload tail.
+func (s *ShardedWriter) leaf(idx int64) (*shardLeaf, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, xerrors.New("write to a closed ShardedWriter")
+	}
+	l, ok := s.pending[idx]
+	if !ok {
+		if idx < int64(len(s.leaves)) && s.leaves[idx] != nil || idx == int64(len(s.leaves)) && s.tail != nil {
+			return nil, xerrors.Errorf("leaf %d was written more than once", idx)
+		}
+		leafLen := s.leafLen
+		if rest := s.size - idx*s.leafLen; rest < leafLen {
+			leafLen = rest
+		}
+		l = &shardLeaf{buf: getLeafBuf(int(s.leafLen))[:leafLen]}
+		s.pending[idx] = l
+	}
+	return l, nil
+}
+
+// complete queues a fully written leaf for hashing, its commitment to be
+// sent to result
+func (s *ShardedWriter) complete(idx int64, buf []byte, result chan leafResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.summed || s.closed {
+		return xerrors.Errorf("leaf %d was completed after Sum or Close", idx)
+	}
+	// submitting under the lock keeps Sum from stopping the workers while a
+	// leaf is being queued
+	return s.pool.submit(context.Background(), leafJob{ctx: context.Background(), buf: buf, result: result, progress: s.progress})
+}
+
+// Sum waits for all leaves and returns the piece commitment of the payload.
+// It fails if not every byte of the payload has been written.
+func (s *ShardedWriter) Sum() (DataCIDSize, error) {
+	return s.SumContext(context.Background())
+}
+
+// SumContext is like Sum, but stops waiting for outstanding leaves and
+// returns ctx.Err() when ctx is canceled.
+func (s *ShardedWriter) SumContext(ctx context.Context) (DataCIDSize, error) {
+	s.mu.Lock()
+	written, tail, closed := s.written, s.tail, s.closed
+	s.mu.Unlock()
+	if closed {
+		return DataCIDSize{}, xerrors.New("sum of a closed ShardedWriter")
+	}
+	if written != s.size {
+		return DataCIDSize{}, xerrors.Errorf("only %d of %d payload bytes have been written", written, s.size)
+	}
+
+	leaves := make([]commitment, len(s.leaves))
+	for i, leaf := range s.leaves {
+		if leaf == nil {
+			return DataCIDSize{}, xerrors.Errorf("leaf %d was never completed", i)
+		}
+
+		var r leafResult
+		select {
+		case r = <-leaf:
+		case <-ctx.Done():
+			return DataCIDSize{}, ctx.Err()
+		}
+		if r.err != nil {
+			return DataCIDSize{}, s.cfg.leafError(i, r.err)
+		}
+		leaves[i] = r.commP
+	}
+
+	s.mu.Lock()
+	if !s.summed {
+		s.summed = true
+		s.pool.stop()
+	}
+	s.mu.Unlock()
+
+	start := time.Now()
+	sum, err := s.cfg.sumLeaves(leaves, tail[:cap(tail)], len(tail))
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+	sum.Timings.Tree = time.Since(start)
+	s.progress.done(&sum)
+	return sum, nil
+}
+
+// Close releases the hashing workers and the buffers of the leaves not
+// hashed yet. It must not be called concurrently with WriteAt or Sum, after
+// which the writer cannot be used anymore.
+func (s *ShardedWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if !s.summed {
+		s.pool.stop()
+	}
+	for idx, l := range s.pending {
+		putLeafBuf(l.buf)
+		delete(s.pending, idx)
+	}
+	if s.tail != nil {
+		putLeafBuf(s.tail)
+		s.tail = nil
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package fastcommp
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+)
+
+// shard is a range of a payload
+type shard struct {
+	off, end int
+}
+
+// randomShards cuts size bytes into shards of up to max bytes, in random order
+func randomShards(rng *rand.Rand, size, max int) []shard {
+	var shards []shard
+	for off := 0; off < size; {
+		end := off + 1 + rng.Intn(max)
+		if end > size {
+			end = size
+		}
+		shards = append(shards, shard{off, end})
+		off = end
+	}
+	rng.Shuffle(len(shards), func(i, j int) { shards[i], shards[j] = shards[j], shards[i] })
+	return shards
+}
+
+func TestShardedWriter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, leafSize := range []abi.PaddedPieceSize{128, 1024} {
+		for _, size := range []int{65, 127, 1016, 5000, 100000} {
+			data := sparsePayload(rng, size, leafSize)
+			want, wantSize := refPieceCID(t, data)
+			for _, max := range []int{1, 100, 3000} {
+				if size/max > 20000 {
+					continue
+				}
+				for _, goroutines := range []int{1, 8} {
+					name := fmt.Sprintf("%d bytes/leaf %d/shards of up to %d/%d goroutines", size, leafSize, max, goroutines)
+					s, err := NewShardedWriter(int64(size), WithLeafBufferSize(leafSize), WithConcurrency(3))
+					if err != nil {
+						t.Fatal(err)
+					}
+					shards := randomShards(rng, size, max)
+					var wg sync.WaitGroup
+					errs := make(chan error, goroutines)
+					for g := 0; g < goroutines; g++ {
+						wg.Add(1)
+						go func(g int) {
+							defer wg.Done()
+							for i := g; i < len(shards); i += goroutines {
+								sh := shards[i]
+								if _, err := s.WriteAt(data[sh.off:sh.end], int64(sh.off)); err != nil {
+									errs <- err
+									return
+								}
+							}
+						}(g)
+					}
+					wg.Wait()
+					close(errs)
+					for err := range errs {
+						t.Fatalf("%s: %s", name, err)
+					}
+					sum, err := s.Sum()
+					if err != nil {
+						t.Fatalf("%s: %s", name, err)
+					}
+					if !sum.PieceCID.Equals(want) || sum.PieceSize != wantSize || sum.PayloadSize != int64(size) {
+						t.Errorf("%s: %s of %d bytes, expected %s of %d", name, sum.PieceCID, sum.PieceSize, want, wantSize)
+					}
+					s.Close()
+				}
+			}
+		}
+	}
+}
+
+func TestShardedWriterIncomplete(t *testing.T) {
+	s, err := NewShardedWriter(1000, WithLeafBufferSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.WriteAt(make([]byte, 500), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteAt(make([]byte, 10), 995); err == nil {
+		t.Errorf("a write past the end of the payload succeeded")
+	}
+	if _, err := s.Sum(); err == nil {
+		t.Errorf("the sum of half a payload succeeded")
+	}
+}
+
+func TestShardedWriterRewrite(t *testing.T) {
+	// 3 leaves of 127 bytes and a tail of 100
+	s, err := NewShardedWriter(3*127+100, WithLeafBufferSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.WriteAt(make([]byte, 127), 127); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteAt(make([]byte, 100), 3*127); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		off  int64
+		n    int
+	}{
+		{"into a hashed leaf", 130, 1},
+		{"over a hashed leaf", 100, 50},
+		{"into the tail", 3*127 + 99, 1},
+	} {
+		if _, err := s.WriteAt(make([]byte, tc.n), tc.off); err == nil {
+			t.Errorf("a write %s succeeded", tc.name)
+		}
+	}
+}
+
+func TestShardedWriterClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		s, err := NewShardedWriter(10000, WithLeafBufferSize(128), WithConcurrency(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.WriteAt(make([]byte, 5000), 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Sum(); err == nil {
+			t.Fatal("the sum of half a payload succeeded")
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.WriteAt(make([]byte, 10), 6000); err == nil {
+			t.Errorf("a write after Close succeeded")
+		}
+		if _, err := s.Sum(); err == nil {
+			t.Errorf("a sum after Close succeeded")
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("closing twice: %s", err)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after closing the writers, %d before", after, before)
+	}
+
+	// closing after a successful Sum is fine too
+	s, err := NewShardedWriter(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WriteAt(make([]byte, 1000), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sum(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package fastcommp
+
+import (
+	"hash"
+	"math/bits"
+
+	"github.com/filecoin-project/go-commp-utils/zerocomm"
+	"github.com/filecoin-project/go-state-types/abi"
+	sha256simd "github.com/minio/sha256-simd"
+)
+
+// stackFrame is the root of a complete subtree on a merkleStack
+type stackFrame struct {
+	size  abi.PaddedPieceSize
+	commP commitment
+}
+
+// merkleStack folds consecutive leaf commitments into the roots of complete
+// subtrees as they are pushed, so it holds at most one commitment per tree
+// level no matter how many leaves the payload has.
+type merkleStack struct {
+	frames []stackFrame
+	leaves int
+	h      hash.Hash
+}
+
+// pushLeaf pushes the commitment of the next leaf of the payload
+func (s *merkleStack) pushLeaf(size abi.PaddedPieceSize, commP commitment) {
+	s.leaves++
+	s.push(size, commP)
+}
+
+// push pushes the root of the next complete subtree, which must start at a
+// multiple of its size
+func (s *merkleStack) push(size abi.PaddedPieceSize, commP commitment) {
+	s.frames = s.reduce(append(s.frames, stackFrame{size: size, commP: commP}))
+}
+
+// root pads the stack with zero subtrees until it collapses into a single
+// power-of-two tree and returns that tree's root. The stack is unchanged.
+func (s *merkleStack) root() stackFrame {
+	frames := append([]stackFrame(nil), s.frames...)
+	for len(frames) > 1 {
+		top := frames[len(frames)-1]
+		frames = s.reduce(append(frames, stackFrame{size: top.size, commP: zeroCommitment(top.size)}))
+	}
+	return frames[0]
+}
+
+// reduce combines the top two frames of the stack for as long as they are
+// siblings of the same size
+func (s *merkleStack) reduce(frames []stackFrame) []stackFrame {
+	for n := len(frames); n > 1 && frames[n-2].size == frames[n-1].size; n = len(frames) {
+		frames[n-2] = stackFrame{
+			size:  2 * frames[n-2].size,
+			commP: s.node(frames[n-2].commP, frames[n-1].commP),
+		}
+		frames = frames[:n-1]
+	}
+	return frames
+}
+
+// node returns the commitment of the parent of left and right
+func (s *merkleStack) node(left, right commitment) commitment {
+	if s.h == nil {
+		s.h = sha256simd.New()
+	}
+	return hashNode(s.h, left, right)
+}
+
+// zeroCommitment is the commitment of size bytes of zeros
+func zeroCommitment(size abi.PaddedPieceSize) commitment {
+	return zerocomm.PieceComms[bits.TrailingZeros64(uint64(size))-7]
+}
@@ -0,0 +1,174 @@
+package fastcommp
+
+import (
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+	"golang.org/x/xerrors"
+)
+
+// stateVersion is bumped whenever writerState changes incompatibly
+const stateVersion = 2
+
+// writerState is the CBOR checkpoint of a CommpWriter
+type writerState struct {
+	Version   int
+	LeafSize  uint64
+	Streaming bool
+	Length    int64
+	Folded    int
+	Stack     []stateFrame
+	Leaves    []cid.Cid
+	Partial   []byte
+}
+
+// stateFrame is a merkleStack frame of a streaming writer
+type stateFrame struct {
+	Size  uint64
+	CommP []byte
+}
+
+func init() {
+	cbornode.RegisterCborType(writerState{})
+	cbornode.RegisterCborType(stateFrame{})
+}
+
+// MarshalState waits for all outstanding leaves and serializes the writer's
+// progress: the number of bytes written, the commitments of all completed
+// leaves and the partially filled leaf buffer. The writer remains usable.
+//
+// Restoring the state with UnmarshalState lets an interrupted job resume
+// writing the payload at the returned offset instead of starting over.
+func (w *CommpWriter) MarshalState() ([]byte, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	resolved, err := w.resolveLeaves()
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := leafCIDs(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	st := writerState{
+		Version:  stateVersion,
+		LeafSize: uint64(w.cfg.leafSize),
+		Length:   w.len,
+		Leaves:   leaves,
+		Partial:  w.buf[:w.len%int64(len(w.buf))],
+	}
+	if w.stack != nil {
+		st.Streaming = true
+		st.Folded = w.stack.leaves
+		for _, f := range w.stack.frames {
+			st.Stack = append(st.Stack, stateFrame{Size: uint64(f.size), CommP: append([]byte(nil), f.commP[:]...)})
+		}
+	}
+	return cbornode.DumpObject(&st)
+}
+
+// UnmarshalState restores progress saved by MarshalState, discarding anything
+// written to w so far. A zero-value writer adopts the leaf size and streaming
+// mode of the state; a writer configured with a different leaf size, or the
+// state of a streaming writer restored into a non-streaming one, returns an
+// error.
+func (w *CommpWriter) UnmarshalState(data []byte) error {
+	var st writerState
+	if err := cbornode.DecodeInto(data, &st); err != nil {
+		return xerrors.Errorf("decoding writer state: %w", err)
+	}
+	if st.Version != stateVersion {
+		return xerrors.Errorf("unsupported writer state version %d", st.Version)
+	}
+
+	leafSize := abi.PaddedPieceSize(st.LeafSize)
+	if err := leafSize.Validate(); err != nil {
+		return xerrors.Errorf("invalid leaf size in writer state: %w", err)
+	}
+	streaming := st.Streaming
+	if !streaming && (st.Folded != 0 || len(st.Stack) != 0) {
+		return xerrors.New("inconsistent writer state: folded leaves without streaming")
+	}
+	if w.buf == nil {
+		cfg := defaultConfig()
+		cfg.leafSize = leafSize
+		cfg.streaming = streaming
+		w.init(cfg)
+	} else if w.cfg.leafSize != leafSize {
+		return xerrors.Errorf("writer state has leaf size %d, writer is configured for %d", leafSize, w.cfg.leafSize)
+	} else if streaming && w.stack == nil {
+		return xerrors.New("writer state was saved in streaming mode, writer is not streaming")
+	}
+
+	leafLen := int64(leafSize.Unpadded())
+	if st.Length < 0 || st.Length/leafLen != int64(st.Folded+len(st.Leaves)) || st.Length%leafLen != int64(len(st.Partial)) {
+		return xerrors.Errorf("inconsistent writer state: %d bytes with %d leaves and %d buffered bytes", st.Length, st.Folded+len(st.Leaves), len(st.Partial))
+	}
+
+	leaves, err := leafCommitments(st.Leaves)
+	if err != nil {
+		return xerrors.Errorf("invalid writer state: %w", err)
+	}
+	// the frames are the roots of the complete subtrees of the folded
+	// leaves, from the largest down
+	frames := make([]stackFrame, len(st.Stack))
+	var folded abi.PaddedPieceSize
+	for i, f := range st.Stack {
+		size := abi.PaddedPieceSize(f.Size)
+		if err := size.Validate(); err != nil || size < leafSize || (i > 0 && size >= frames[i-1].size) {
+			return xerrors.Errorf("invalid writer state: stack frame %d of %d bytes", i, size)
+		}
+		commP, err := newCommitment(f.CommP)
+		if err != nil {
+			return xerrors.Errorf("invalid writer state: decoding stack frame %d: %w", i, err)
+		}
+		frames[i] = stackFrame{size: size, commP: commP}
+		folded += size
+	}
+	if folded != leafSize*abi.PaddedPieceSize(st.Folded) {
+		return xerrors.Errorf("inconsistent writer state: %d folded leaves in a stack of %d bytes", st.Folded, folded)
+	}
+
+	w.Reset()
+	if streaming {
+		w.stack.leaves = st.Folded
+		w.stack.frames = frames
+	}
+	w.len = st.Length
+	w.progress = newProgress(w.cfg, st.Folded+len(leaves))
+	w.leaves = make([]chan leafResult, len(leaves))
+	for i, c := range leaves {
+		w.leaves[i] = resolvedLeaf(c)
+	}
+	copy(w.buf, st.Partial)
+	return nil
+}
+
+// resolveLeaves waits for every dispatched leaf and returns their
+// commitments, leaving w.leaves ready to be read again
+func (w *CommpWriter) resolveLeaves() ([]commitment, error) {
+	leaves := make([]commitment, len(w.leaves))
+	for i, leaf := range w.leaves {
+		r := <-leaf
+		w.leaves[i] = make(chan leafResult, 1)
+		w.leaves[i] <- r
+		if r.err != nil {
+			return nil, w.cfg.leafError(w.folded()+i, r.err)
+		}
+		leaves[i] = r.commP
+	}
+	return leaves, nil
+}
+
+// resolvedLeaf returns a leaf channel that already holds commP
+func resolvedLeaf(commP commitment) chan leafResult {
+	leaf := make(chan leafResult, 1)
+	leaf <- leafResult{commP: commP}
+	return leaf
+}
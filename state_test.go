@@ -0,0 +1,178 @@
+package fastcommp
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+func TestWriterState(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	const leafSize = abi.PaddedPieceSize(256)
+	leaf := int(leafSize.Unpadded())
+	for _, size := range []int{65, 1000, 20000} {
+		data := sparsePayload(rng, size, leafSize)
+		want, wantSize := refPieceCID(t, data)
+		for _, split := range []int{0, 1, leaf - 1, leaf, leaf + 7, 3 * leaf, size / 2, size - 1, size} {
+			if split > size {
+				continue
+			}
+			for _, streaming := range []bool{false, true} {
+				for _, zero := range []bool{false, true} {
+					name := fmt.Sprintf("%d bytes/split at %d/streaming %t/zero-value writer %t", size, split, streaming, zero)
+					opts := []Option{WithLeafBufferSize(leafSize), WithConcurrency(2)}
+					if streaming {
+						opts = append(opts, WithStreaming())
+					}
+					w, err := NewCommpWriter(opts...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := w.Write(data[:split]); err != nil {
+						t.Fatal(err)
+					}
+					state, err := w.MarshalState()
+					if err != nil {
+						t.Fatalf("%s: %s", name, err)
+					}
+					w.Close()
+
+					// a zero-value writer adopts the configuration of the state
+					r := new(CommpWriter)
+					if !zero {
+						if r, err = NewCommpWriter(opts...); err != nil {
+							t.Fatal(err)
+						}
+					}
+					if err := r.UnmarshalState(state); err != nil {
+						t.Fatalf("%s: %s", name, err)
+					}
+					if _, err := r.Write(data[split:]); err != nil {
+						t.Fatal(err)
+					}
+					sum, err := r.Sum()
+					if err != nil {
+						t.Fatalf("%s: %s", name, err)
+					}
+					if !sum.PieceCID.Equals(want) || sum.PieceSize != wantSize || sum.PayloadSize != int64(size) {
+						t.Errorf("%s: %s of %d bytes, expected %s of %d", name, sum.PieceCID, sum.PieceSize, want, wantSize)
+					}
+					r.Close()
+				}
+			}
+		}
+	}
+}
+
+func TestWriterStateMismatch(t *testing.T) {
+	w, err := NewCommpWriter(WithLeafBufferSize(256), WithStreaming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	state, err := w.MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]Option{
+		{WithLeafBufferSize(512), WithStreaming()},
+		{WithLeafBufferSize(256)},
+	} {
+		r, err := NewCommpWriter(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.UnmarshalState(state); err == nil {
+			t.Errorf("the state restored into a writer of another configuration")
+		}
+		r.Close()
+	}
+	if err := new(CommpWriter).UnmarshalState(state[:len(state)-1]); err == nil {
+		t.Errorf("a truncated state restored")
+	}
+}
+
+func TestWriterStateStreaming(t *testing.T) {
+	// a streaming writer that has not folded a leaf yet stays streaming
+	w, err := NewCommpWriter(WithLeafBufferSize(256), WithStreaming())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	state, err := w.MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := new(CommpWriter)
+	if err := r.UnmarshalState(state); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.stack == nil {
+		t.Errorf("the state of a streaming writer restored a non-streaming one")
+	}
+}
+
+func TestWriterStateCorrupt(t *testing.T) {
+	w, err := NewCommpWriter(WithLeafBufferSize(256), WithStreaming(), WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// write leaves until they fold into at least two frames
+	var state []byte
+	var st writerState
+	for i := 0; len(st.Stack) < 2; i++ {
+		if i == 100 {
+			t.Fatalf("%d leaves folded into %d frames", st.Folded, len(st.Stack))
+		}
+		if _, err := w.Write(make([]byte, 254)); err != nil {
+			t.Fatal(err)
+		}
+		if state, err = w.MarshalState(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cbornode.DecodeInto(state, &st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !st.Streaming {
+		t.Fatalf("the state of a streaming writer is not streaming")
+	}
+	if err := new(CommpWriter).UnmarshalState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(st *writerState)
+	}{
+		{"not streaming", func(st *writerState) { st.Streaming = false }},
+		{"frame not a power of two", func(st *writerState) { st.Stack[0].Size = 1000 }},
+		{"frame smaller than a leaf", func(st *writerState) { st.Stack[len(st.Stack)-1].Size = 128 }},
+		{"frames in increasing order", func(st *writerState) { st.Stack[0], st.Stack[1] = st.Stack[1], st.Stack[0] }},
+		{"frames of the same size", func(st *writerState) { st.Stack[0].Size = st.Stack[1].Size }},
+		{"frames of other leaves", func(st *writerState) { st.Folded, st.Length = 6, st.Length+254 }},
+		{"old version", func(st *writerState) { st.Version = 1 }},
+	} {
+		c := st
+		c.Stack = append([]stateFrame(nil), st.Stack...)
+		tc.modify(&c)
+		data, err := cbornode.DumpObject(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := new(CommpWriter).UnmarshalState(data); err == nil {
+			t.Errorf("%s: the state restored", tc.name)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package fastcommp
+
+import (
+	"hash"
+	"math/bits"
+	"sync"
+
+	commp "github.com/filecoin-project/go-fil-commp-hashhash"
+	"github.com/filecoin-project/go-state-types/abi"
+	sha256simd "github.com/minio/sha256-simd"
+	"golang.org/x/xerrors"
+)
+
+// sumLeaves builds the final result from the commitments of all full leaves
+// and the tailLen bytes of payload left over in the leaf-sized buf. The part
+// of buf past the tail is overwritten with zeros.
+func (c config) sumLeaves(leaves []commitment, buf []byte, tailLen int) (DataCIDSize, error) {
+	payloadSize := int64(len(leaves))*int64(c.leafSize.Unpadded()) + int64(tailLen)
+	if payloadSize == 0 {
+		return DataCIDSize{}, xerrors.New("commP is not defined for an empty payload")
+	}
+
+	// process remaining bit of data
+	if tailLen != 0 {
+		var p commitment
+		if len(leaves) != 0 {
+			var err error
+			if p, err = c.tailLeaf(buf, tailLen, len(leaves)); err != nil {
+				return DataCIDSize{}, err
+			}
+		} else {
+			// like the lotus client, pad a payload too small for commP with
+			// zeros when it is sealed into a sector of its own, or padded to
+			// a target piece size
+			if min := int(minPieceSize.Unpadded()); c.paddedSize() != 0 && tailLen < min {
+				copy(buf[tailLen:min], make([]byte, min-tailLen))
+				tailLen = min
+			}
+			cc := new(commp.Calc)
+			if _, err := cc.Write(buf[:tailLen]); err != nil {
+				return DataCIDSize{}, c.leafError(0, err)
+			}
+			pb, pps, err := cc.Digest()
+			if err != nil {
+				return DataCIDSize{}, c.leafError(0, err)
+			}
+			if p, err = newCommitment(pb); err != nil {
+				return DataCIDSize{}, c.leafError(0, err)
+			}
+
+			// if the only piece is less than a leaf, we're done
+			if abi.PaddedPieceSize(pps) < c.leafSize {
+				return c.newSum(payloadSize, abi.PaddedPieceSize(pps), 1, p)
+			}
+		}
+
+		leaves = append(leaves, p)
+	}
+
+	leafCount := len(leaves)
+	p, pieceSize := c.pieceTree(leaves)
+	return c.newSum(payloadSize, pieceSize, leafCount, p)
+}
+
+// sumStack is like sumLeaves for a streaming writer, whose first leaves have
+// already been folded into st
+func (c config) sumStack(st *merkleStack, leaves []commitment, buf []byte, tailLen int) (DataCIDSize, error) {
+	payloadSize := int64(st.leaves+len(leaves))*int64(c.leafSize.Unpadded()) + int64(tailLen)
+
+	for _, leaf := range leaves {
+		st.pushLeaf(c.leafSize, leaf)
+	}
+	if tailLen != 0 {
+		p, err := c.tailLeaf(buf, tailLen, st.leaves)
+		if err != nil {
+			return DataCIDSize{}, err
+		}
+		st.pushLeaf(c.leafSize, p)
+	}
+
+	root := st.root()
+	return c.newSum(payloadSize, root.size, st.leaves, root.commP)
+}
+
+// newSum returns the result for the piece with commitment commP, padded to
+// the target piece size or the sector of the seal proof if any
+func (c config) newSum(payloadSize int64, pieceSize abi.PaddedPieceSize, leafCount int, commP commitment) (DataCIDSize, error) {
+	padded := c.paddedSize()
+	if padded == 0 {
+		return newDataCIDSize(payloadSize, pieceSize, leafCount, commP)
+	}
+	if pieceSize > padded {
+		what := "a sector"
+		if c.targetSize != 0 {
+			what = "a target piece"
+		}
+		return DataCIDSize{}, xerrors.Errorf("a payload of %d bytes does not fit in %s of %d bytes, which holds at most %d", payloadSize, what, padded, padded.Unpadded())
+	}
+
+	// the padded piece is the piece followed by zero subtrees of its size,
+	// then of twice that and so on
+	h := sha256simd.New()
+	for ; pieceSize < padded; pieceSize *= 2 {
+		commP = hashNode(h, commP, zeroCommitment(pieceSize))
+	}
+	return newDataCIDSize(payloadSize, pieceSize, leafCount, commP)
+}
+
+// tailLeaf zero-fills the tailLen bytes at the start of buf up to a full leaf
+// and hashes it as leaf idx
+func (c config) tailLeaf(buf []byte, tailLen int, idx int) (commitment, error) {
+	copy(buf[tailLen:], make([]byte, len(buf)-tailLen))
+	p, err := c.hashLeaf(buf)
+	if err != nil {
+		return commitment{}, c.leafError(idx, err)
+	}
+	return p, nil
+}
+
+// minPairsPerWorker is the number of nodes a tree level must produce per
+// goroutine before hashing it is split across goroutines
+const minPairsPerWorker = 1024
+
+// pieceTree folds the commitments of full leaves into the root commitment of
+// the whole payload, padding with zero leaves up to a power-of-two leaf count.
+// Each level of the tree is hashed by up to c.concurrency goroutines.
+func (c config) pieceTree(leaves []commitment) (commitment, abi.PaddedPieceSize) {
+	nodes := make([]commitment, len(leaves), 1<<bits.Len(uint(len(leaves)-1)))
+	copy(nodes, leaves)
+
+	// pad with zero pieces to power-of-two size
+	zero := zeroCommitment(c.leafSize)
+	for len(nodes) < cap(nodes) {
+		nodes = append(nodes, zero)
+	}
+
+	pieceSize := abi.PaddedPieceSize(len(nodes)) * c.leafSize
+	for len(nodes) > 1 {
+		nodes = c.reduceLevel(nodes)
+	}
+	return nodes[0], pieceSize
+}
+
+// reduceLevel hashes each pair of nodes into their parent, returning the next
+// level up the tree
+func (c config) reduceLevel(nodes []commitment) []commitment {
+	parents := make([]commitment, len(nodes)/2)
+
+	workers := len(parents) / minPairsPerWorker
+	if workers > c.concurrency {
+		workers = c.concurrency
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	per := (len(parents) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(parents); start += per {
+		end := start + per
+		if end > len(parents) {
+			end = len(parents)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+
+			h := sha256simd.New()
+			for i := start; i < end; i++ {
+				parents[i] = hashNode(h, nodes[2*i], nodes[2*i+1])
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return parents
+}
+
+// hashNode returns the commitment of the parent of left and right using h
+func hashNode(h hash.Hash, left, right commitment) commitment {
+	h.Reset()
+	h.Write(left[:])
+	h.Write(right[:])
+
+	// Sum appends to the empty slice in place, filling d
+	var d commitment
+	h.Sum(d[:0])
+	d[31] &= 0b00111111
+	return d
+}
@@ -0,0 +1,343 @@
+package fastcommp
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// leafResult is the commitment of a hashed leaf, or the error hashing it
+type leafResult struct {
+	commP commitment
+	err   error
+}
+
+// CommpWriter is a writer that calculates the CommP. The zero value is ready
+// to use with the default configuration; use NewCommpWriter to tune it.
+//
+// A CommpWriter consumes the payload in order and must not be written to
+// from multiple goroutines at once; use a ShardedWriter to hash disjoint
+// ranges of a payload concurrently.
+type CommpWriter struct {
+	cfg    config
+	len    int64
+	buf    []byte
+	leaves []chan leafResult
+
+	// stack holds the leaves folded so far in streaming mode, and err the
+	// first leaf error encountered while folding
+	stack *merkleStack
+	err   error
+
+	// slots bounds the number of leaves in flight; a full buf is handed to
+	// the hashing worker, which owns it until it returns it to the shared
+	// pool and releases the slot
+	slots chan struct{}
+	// pool hashes dispatched leaves; it is started by the first dispatch and
+	// stopped once Sum or Reset no longer has leaves in flight
+	pool *workerPool
+	// progress reports hashed leaves to the WithProgress callback, if any
+	progress *progress
+}
+
+var (
+	_ io.ReaderFrom = &CommpWriter{}
+	_ io.Closer     = &CommpWriter{}
+)
+
+// NewCommpWriter returns a CommpWriter configured with opts
+func NewCommpWriter(opts ...Option) (*CommpWriter, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(CommpWriter)
+	w.init(cfg)
+	return w, nil
+}
+
+// init sets up the writer for cfg
+func (w *CommpWriter) init(cfg config) {
+	w.cfg = cfg
+	w.buf = getLeafBuf(int(cfg.leafSize.Unpadded()))
+	w.slots = make(chan struct{}, cfg.concurrency)
+	w.progress = newProgress(cfg, 0)
+	if cfg.streaming {
+		w.stack = new(merkleStack)
+	}
+}
+
+// Reset discards everything written so far so the writer can be reused for
+// another payload, keeping its leaf buffer and configuration. It waits for
+// leaves that are still being hashed and releases the hashing workers.
+func (w *CommpWriter) Reset() {
+	if w.buf == nil {
+		return
+	}
+	w.drain()
+
+	w.len = 0
+	w.leaves = nil
+	w.err = nil
+	w.progress = newProgress(w.cfg, 0)
+	if w.stack != nil {
+		w.stack = new(merkleStack)
+	}
+}
+
+// Close waits for leaves that are still being hashed and returns the writer's
+// leaf buffer to the pool shared by all writers, so that the next writer can
+// reuse it. The writer must not be used after Close.
+func (w *CommpWriter) Close() error {
+	if w.buf == nil {
+		return nil
+	}
+	w.drain()
+	putLeafBuf(w.buf)
+	w.buf = nil
+	return nil
+}
+
+// drain waits until no leaf is in flight and releases the hashing workers
+func (w *CommpWriter) drain() {
+	// fill every slot to make sure no leaf is still in flight
+	for i := 0; i < cap(w.slots); i++ {
+		w.slots <- struct{}{}
+	}
+	for i := 0; i < cap(w.slots); i++ {
+		<-w.slots
+	}
+	w.stopWorkers()
+}
+
+// Write writes data to the CommpWriter
+func (w *CommpWriter) Write(p []byte) (int, error) {
+	return w.WriteContext(context.Background(), p)
+}
+
+// WriteContext is like Write, but gives up waiting for a free hashing slot
+// when ctx is canceled, returning the number of bytes consumed and ctx.Err().
+// Leaves dispatched under a canceled ctx are not hashed. The writer must not
+// be used further after a cancellation, other than to Reset it.
+func (w *CommpWriter) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+
+	// process last non-zero leaf if exists and we have data to write
+	n := len(p)
+	for len(p) > 0 {
+		buffered := int(w.len % int64(len(w.buf)))
+		toBuffer := len(w.buf) - buffered
+		if toBuffer > len(p) {
+			toBuffer = len(p)
+		}
+
+		copied := copy(w.buf[buffered:], p[:toBuffer])
+		p = p[copied:]
+		w.len += int64(copied)
+
+		// if we filled the buffer, process it
+		if copied > 0 && w.len%int64(len(w.buf)) == 0 {
+			if err := w.dispatch(ctx); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// WriteZeros writes n zero bytes. Zero leaves that start on a leaf boundary
+// are not hashed but take the precomputed commitment of an all-zero leaf, so
+// the holes of sparse files cost next to nothing.
+func (w *CommpWriter) WriteZeros(n int64) (int64, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+
+	leafLen := int64(len(w.buf))
+	var written int64
+	for written < n {
+		buffered := w.len % leafLen
+		if buffered == 0 && n-written >= leafLen {
+			if w.err != nil {
+				return written, w.err
+			}
+			w.leaves = append(w.leaves, resolvedLeaf(zeroCommitment(w.cfg.leafSize)))
+			w.len += leafLen
+			written += leafLen
+			w.progress.leafHashed(0)
+			if err := w.fold(context.Background()); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		chunk := leafLen - buffered
+		if chunk > n-written {
+			chunk = n - written
+		}
+		clear(w.buf[buffered : buffered+chunk])
+		w.len += chunk
+		written += chunk
+		if w.len%leafLen == 0 {
+			if err := w.dispatch(context.Background()); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads r until EOF straight into the leaf buffer, so io.Copy can
+// feed the writer without an intermediate copy buffer.
+func (w *CommpWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+
+	var total int64
+	for {
+		buffered := int(w.len % int64(len(w.buf)))
+		n, err := r.Read(w.buf[buffered:])
+		w.len += int64(n)
+		total += int64(n)
+
+		// if we filled the buffer, process it
+		if n > 0 && w.len%int64(len(w.buf)) == 0 {
+			if derr := w.dispatch(context.Background()); derr != nil {
+				return total, derr
+			}
+		}
+
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// dispatch queues the full leaf buffer for the hashing workers as soon as a
+// hashing slot is free, and replaces it with a buffer from the shared pool
+func (w *CommpWriter) dispatch(ctx context.Context) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.pool == nil {
+		w.pool = startWorkers(w.cfg)
+	}
+
+	select {
+	case w.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// hand the full buffer itself to the worker, which owns it until it
+	// returns it to the shared pool, and keep filling a fresh one
+	buf := w.buf
+	leaf := make(chan leafResult, 1)
+	if err := w.pool.submit(ctx, leafJob{ctx: ctx, buf: buf, result: leaf, progress: w.progress, slot: w.slots}); err != nil {
+		<-w.slots
+		return err
+	}
+	w.buf = getLeafBuf(len(buf))
+
+	// add leaf to list
+	w.leaves = append(w.leaves, leaf)
+	return w.fold(ctx)
+}
+
+// stopWorkers releases the hashing workers; they are started again by the
+// next dispatch
+func (w *CommpWriter) stopWorkers() {
+	if w.pool != nil {
+		w.pool.stop()
+		w.pool = nil
+	}
+}
+
+// fold moves leaves that can no longer be in flight from w.leaves onto the
+// merkle stack of a streaming writer
+func (w *CommpWriter) fold(ctx context.Context) error {
+	for w.stack != nil && len(w.leaves) > w.cfg.concurrency {
+		var r leafResult
+		select {
+		case r = <-w.leaves[0]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		idx := w.stack.leaves
+		if r.err != nil {
+			w.err = w.cfg.leafError(idx, r.err)
+			return w.err
+		}
+		w.stack.pushLeaf(w.cfg.leafSize, r.commP)
+		w.leaves = w.leaves[1:]
+	}
+	return nil
+}
+
+// folded is the number of leaves already folded onto the merkle stack
+func (w *CommpWriter) folded() int {
+	if w.stack == nil {
+		return 0
+	}
+	return w.stack.leaves
+}
+
+// Sum waits for all outstanding leaves and returns the piece commitment of
+// everything written so far
+func (w *CommpWriter) Sum() (DataCIDSize, error) {
+	return w.SumContext(context.Background())
+}
+
+// SumContext is like Sum, but stops waiting for outstanding leaves and
+// returns ctx.Err() when ctx is canceled.
+func (w *CommpWriter) SumContext(ctx context.Context) (DataCIDSize, error) {
+	if w.buf == nil {
+		w.init(defaultConfig())
+	}
+	if w.err != nil {
+		return DataCIDSize{}, w.err
+	}
+
+	// wait for all leaves to finish
+	leaves := make([]commitment, len(w.leaves))
+	for i, leaf := range w.leaves {
+		var r leafResult
+		select {
+		case r = <-leaf:
+		case <-ctx.Done():
+			return DataCIDSize{}, ctx.Err()
+		}
+		if r.err != nil {
+			return DataCIDSize{}, w.cfg.leafError(w.folded()+i, r.err)
+		}
+		leaves[i] = r.commP
+	}
+	w.stopWorkers()
+
+	// process remaining bit of data
+	tailLen := int(w.len % int64(len(w.buf)))
+	var (
+		sum DataCIDSize
+		err error
+	)
+	start := time.Now()
+	if w.folded() > 0 {
+		sum, err = w.cfg.sumStack(w.stack, leaves, w.buf, tailLen)
+	} else {
+		sum, err = w.cfg.sumLeaves(leaves, w.buf, tailLen)
+	}
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+	sum.Timings.Tree = time.Since(start)
+	w.progress.done(&sum)
+	return sum, nil
+}
@@ -0,0 +1,223 @@
+package fastcommp
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	commcid "github.com/filecoin-project/go-fil-commcid"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+// refPieceCID returns the piece CID and size of payload by
+// go-fil-commp-hashhash
+func refPieceCID(t testing.TB, payload []byte) (cid.Cid, abi.PaddedPieceSize) {
+	t.Helper()
+	commP, size := refCommP(t, payload)
+	c, err := commcid.DataCommitmentV1ToCID(commP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, abi.PaddedPieceSize(size)
+}
+
+// sparsePayload returns size random bytes with runs of zeros, some of them
+// longer than a leaf of leafSize
+func sparsePayload(rng *rand.Rand, size int, leafSize abi.PaddedPieceSize) []byte {
+	data := make([]byte, size)
+	rng.Read(data)
+	leaf := int(leafSize.Unpadded())
+	for off := rng.Intn(leaf); off < size; off += 1 + rng.Intn(4*leaf) {
+		end := off + rng.Intn(3*leaf)
+		if end > size {
+			end = size
+		}
+		clear(data[off:end])
+		off = end
+	}
+	return data
+}
+
+// writePattern feeds data to w in a way of writing it
+type writePattern struct {
+	name  string
+	write func(w *CommpWriter, data []byte, rng *rand.Rand, leafSize abi.PaddedPieceSize) error
+}
+
+var writePatterns = []writePattern{
+	{"one write", func(w *CommpWriter, data []byte, _ *rand.Rand, _ abi.PaddedPieceSize) error {
+		_, err := w.Write(data)
+		return err
+	}},
+	{"1-byte writes", func(w *CommpWriter, data []byte, _ *rand.Rand, _ abi.PaddedPieceSize) error {
+		for i := range data {
+			if _, err := w.Write(data[i : i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"1-3-byte writes", func(w *CommpWriter, data []byte, rng *rand.Rand, _ abi.PaddedPieceSize) error {
+		for len(data) > 0 {
+			n := 1 + rng.Intn(3)
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := w.Write(data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}},
+	{"writes straddling leaves", func(w *CommpWriter, data []byte, rng *rand.Rand, leafSize abi.PaddedPieceSize) error {
+		// each write ends a few bytes either side of a leaf boundary
+		leaf := int(leafSize.Unpadded())
+		next := leaf - 1 - rng.Intn(2)
+		for len(data) > 0 {
+			n := next
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := w.Write(data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+			next = leaf + rng.Intn(5) - 2
+		}
+		return nil
+	}},
+	{"one-byte reads", func(w *CommpWriter, data []byte, _ *rand.Rand, _ abi.PaddedPieceSize) error {
+		_, err := w.ReadFrom(iotest.OneByteReader(bytes.NewReader(data)))
+		return err
+	}},
+	{"short reads", func(w *CommpWriter, data []byte, _ *rand.Rand, _ abi.PaddedPieceSize) error {
+		_, err := w.ReadFrom(iotest.HalfReader(bytes.NewReader(data)))
+		return err
+	}},
+	{"zeros and small writes", func(w *CommpWriter, data []byte, rng *rand.Rand, _ abi.PaddedPieceSize) error {
+		// the runs of zeros go to WriteZeros, the rest in 1-7-byte writes
+		for len(data) > 0 {
+			zeros := 0
+			for zeros < len(data) && data[zeros] == 0 {
+				zeros++
+			}
+			if zeros > 0 {
+				if n, err := w.WriteZeros(int64(zeros)); err != nil || n != int64(zeros) {
+					return fmt.Errorf("wrote %d of %d zeros: %v", n, zeros, err)
+				}
+				data = data[zeros:]
+				continue
+			}
+			n := 1 + rng.Intn(7)
+			for i := 0; i < n && i < len(data); i++ {
+				if data[i] == 0 {
+					n = i
+				}
+			}
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := w.Write(data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}},
+}
+
+func TestWriterSmallWrites(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, leafSize := range []abi.PaddedPieceSize{128, 256, 1024, 4096} {
+		for _, size := range []int{65, 126, 127, 128, 254, 1000, 4064, 4065, 20000, 130049} {
+			data := sparsePayload(rng, size, leafSize)
+			want, wantSize := refPieceCID(t, data)
+			for _, streaming := range []bool{false, true} {
+				for _, concurrency := range []int{1, 4} {
+					opts := []Option{WithLeafBufferSize(leafSize), WithConcurrency(concurrency)}
+					if streaming {
+						opts = append(opts, WithStreaming())
+					}
+					for _, p := range writePatterns {
+						name := fmt.Sprintf("%s/%d bytes/leaf %d/streaming %t/concurrency %d", p.name, size, leafSize, streaming, concurrency)
+						w, err := NewCommpWriter(opts...)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if err := p.write(w, data, rng, leafSize); err != nil {
+							t.Fatalf("%s: %s", name, err)
+						}
+						sum, err := w.Sum()
+						if err != nil {
+							t.Fatalf("%s: %s", name, err)
+						}
+						if !sum.PieceCID.Equals(want) || sum.PieceSize != wantSize || sum.PayloadSize != int64(size) {
+							t.Errorf("%s: %s of %d bytes, expected %s of %d", name, sum.PieceCID, sum.PieceSize, want, wantSize)
+						}
+						w.Close()
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWriterReset(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	w, err := NewCommpWriter(WithLeafBufferSize(256), WithConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < 20; i++ {
+		data := sparsePayload(rng, 65+rng.Intn(10000), 256)
+		want, _ := refPieceCID(t, data)
+		if err := writePatterns[i%len(writePatterns)].write(w, data, rng, 256); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := w.Sum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sum.PieceCID.Equals(want) {
+			t.Errorf("payload %d of %d bytes: %s, expected %s", i, len(data), sum.PieceCID, want)
+		}
+		w.Reset()
+	}
+}
+
+// BenchmarkWriter measures the whole writer on a 64MiB payload, leaves hashed
+// in parallel and the tree above them
+func BenchmarkWriter(b *testing.B) {
+	data := make([]byte, 64<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+	for _, leafSize := range []abi.PaddedPieceSize{1 << 20, 8 << 20} {
+		for _, streaming := range []bool{false, true} {
+			opts := []Option{WithLeafBufferSize(leafSize)}
+			if streaming {
+				opts = append(opts, WithStreaming())
+			}
+			b.Run(fmt.Sprintf("%s/leaf %dMiB/streaming %t", SHA256Backend(), leafSize>>20, streaming), func(b *testing.B) {
+				w, err := NewCommpWriter(opts...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer w.Close()
+				b.SetBytes(int64(len(data)))
+				for i := 0; i < b.N; i++ {
+					w.Reset()
+					if _, err := w.Write(data); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := w.Sum(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
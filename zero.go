@@ -0,0 +1,55 @@
+package fastcommp
+
+import (
+	"github.com/filecoin-project/go-commp-utils/zerocomm"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// MaxZeroPieceSize is the largest piece of zeros whose commitment is known
+const MaxZeroPieceSize = abi.PaddedPieceSize(128) << (len(zerocomm.PieceComms) - 1)
+
+// ZeroPieceCID returns the piece CID of size bytes of zeros, a power of two
+// of 128 bytes to MaxZeroPieceSize, such as the pieces padding a deal
+// aggregate to its power-of-two size
+func ZeroPieceCID(size abi.PaddedPieceSize) (cid.Cid, error) {
+	if err := size.Validate(); err != nil {
+		return cid.Undef, xerrors.Errorf("zero piece: %w", err)
+	}
+	if size > MaxZeroPieceSize {
+		return cid.Undef, xerrors.Errorf("zero piece of %d bytes is larger than the largest known, of %d", size, MaxZeroPieceSize)
+	}
+	return zeroCommitment(size).pieceCID()
+}
+
+// SumZeros returns the result of a payload of n zero bytes, as SumBytes of
+// make([]byte, n) would, without hashing anything: Fr32 leaves zeros as
+// they are, so the piece is all zeros and its commitment is known
+func SumZeros(n int64, opts ...Option) (DataCIDSize, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return DataCIDSize{}, err
+	}
+	if n == 0 {
+		return DataCIDSize{}, xerrors.New("commP is not defined for an empty payload")
+	}
+	if n < 0 {
+		return DataCIDSize{}, xerrors.Errorf("invalid payload size %d", n)
+	}
+	// like the lotus client, only a payload sealed into a sector of its own,
+	// or padded to a target piece size, may be too small for commP
+	if n < 65 && cfg.paddedSize() == 0 {
+		return DataCIDSize{}, xerrors.Errorf("commP is not defined for a payload of %d bytes, it takes at least 65", n)
+	}
+
+	pieceSize := minPieceSize
+	for int64(pieceSize.Unpadded()) < n {
+		if pieceSize >= MaxZeroPieceSize {
+			return DataCIDSize{}, xerrors.Errorf("a payload of %d zeros is larger than the largest known zero piece, of %d bytes", n, MaxZeroPieceSize)
+		}
+		pieceSize *= 2
+	}
+	leafLen := int64(cfg.leafSize.Unpadded())
+	return cfg.newSum(n, pieceSize, int((n+leafLen-1)/leafLen), zeroCommitment(pieceSize))
+}